@@ -0,0 +1,166 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+type Config struct {
+	// PluginsDir is where plugin executables are discovered, relative paths
+	// are resolved against Dir().
+	PluginsDir string `json:"pluginsDir"`
+
+	// Tasks holds the options of each task, keyed by task ID.
+	Tasks map[string]map[string]string `json:"tasks"`
+
+	// Profiles holds named option sets, keyed by task ID then profile name.
+	// Every profile gets its own button, running the task with the profile
+	// options on top of the ones in Tasks.
+	Profiles map[string]map[string]map[string]string `json:"profiles"`
+
+	// PathSource picks how the folder of the tasks is tracked: "polling" asks
+	// for it at a fixed interval, "events" follows the Explorer windows as they
+	// change and falls back on polling, "dbus" follows the Linux file managers
+	// like Nautilus and Nemo, "shell" follows the shell of Shell. Empty is
+	// "polling".
+	PathSource string `json:"pathSource"`
+	Shell      Shell  `json:"shell"`
+
+	// LogMaxAgeDays is how long run logs are kept, 0 keeps them forever.
+	LogMaxAgeDays int `json:"logMaxAgeDays"`
+
+	// ReportsDir is where run reports are saved, relative paths are resolved
+	// against Dir(). Empty saves them next to the folder of the run.
+	ReportsDir string `json:"reportsDir"`
+	// ReportFormats are the formats a report is saved as, all of "json",
+	// "csv" and "html" when empty.
+	ReportFormats []string `json:"reportFormats"`
+
+	Notifications Notifications `json:"notifications"`
+
+	// Webhooks get a POST on every run start, finish, failure and cancel.
+	Webhooks []Webhook `json:"webhooks"`
+}
+
+// Webhook is an URL told about the runs.
+type Webhook struct {
+	URL string `json:"url"`
+	// Secret signs the payloads with HMAC-SHA256, empty sends them unsigned.
+	Secret string `json:"secret"`
+	// Events are the ones sent, "start", "finish", "failure" and "cancel",
+	// all of them when empty.
+	Events []string `json:"events"`
+	// TimeoutSeconds limits each attempt, 10 when 0.
+	TimeoutSeconds int `json:"timeoutSeconds"`
+	// Retries is how many times a failed delivery is tried again, 3 when 0,
+	// -1 for none.
+	Retries int `json:"retries"`
+}
+
+// Shell is the shell whose working directory the "shell" path source follows.
+type Shell struct {
+	// Follow is how: "tmux" asks tmux for the path of a pane, "pid" reads the
+	// directory of a process, "osc7" reads the OSC 7 reports a shell writes to
+	// a file. The path of a report is percent-encoded, in bash or zsh the
+	// prompt can run
+	//
+	//	p=${PWD//%/%25}; p=${p//\#/%23}; p=${p//\?/%3F}
+	//	printf '\e]7;file://%s%s\e\\' "${HOSTNAME:-$HOST}" "$p" >file
+	//
+	// The reports of other hosts, like those of an SSH session, are ignored.
+	Follow string `json:"follow"`
+	// Target is the tmux pane, like "work:1.0", empty for the active one; the
+	// process ID; or the file of the reports, relative paths are resolved
+	// against Dir(), empty is "cwd.osc7".
+	Target string `json:"target"`
+}
+
+// Notifications pick how the end of a long run is announced.
+type Notifications struct {
+	// MinSeconds is how long a run must take to notify, shorter runs aren't
+	// announced.
+	MinSeconds int `json:"minSeconds"`
+	// OnlyFailures skips the runs that went fine.
+	OnlyFailures bool `json:"onlyFailures"`
+
+	// Bell rings the terminal bell.
+	Bell bool `json:"bell"`
+	// Desktop is the escape sequence asking the terminal for a desktop
+	// notification, "osc9" or "osc777", empty for none.
+	Desktop string `json:"desktop"`
+	// Title sets the terminal title to the outcome, until the next run.
+	Title bool `json:"title"`
+	// Command is run with the run summary as JSON on stdin, the first item is
+	// the executable and the rest its arguments.
+	Command []string `json:"command"`
+}
+
+func Default() Config {
+	return Config{
+		PluginsDir:    "plugins",
+		Tasks:         map[string]map[string]string{},
+		LogMaxAgeDays: 30,
+		Notifications: Notifications{
+			MinSeconds: 30,
+			Bell:       true,
+			Title:      true,
+		},
+	}
+}
+
+// Dir returns the directory holding the config file and everything else
+// exputils keeps between runs.
+func Dir() (string, error) {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("can't find user config directory: %w", err)
+	}
+	return filepath.Join(base, "exputils"), nil
+}
+
+// Path returns the path of the config file.
+func Path() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.json"), nil
+}
+
+// Load reads the config file, a missing file gives the default config.
+func Load() (Config, error) {
+	cfg := Default()
+
+	path, err := Path()
+	if err != nil {
+		return cfg, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	} else if err != nil {
+		return cfg, fmt.Errorf("can't read config file: %w", err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("can't parse config file '%s': %w", path, err)
+	}
+	if cfg.Tasks == nil {
+		cfg.Tasks = map[string]map[string]string{}
+	}
+	return cfg, nil
+}
+
+// Resolve turns a path from the config file into an absolute one.
+func Resolve(path string) (string, error) {
+	if filepath.IsAbs(path) {
+		return path, nil
+	}
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, path), nil
+}
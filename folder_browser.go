@@ -0,0 +1,271 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	zone "github.com/lrstanley/bubblezone"
+)
+
+var (
+	// ToggleBrowserButton is the divider of the browser, clicking it closes
+	// the browser.
+	ToggleBrowserButton = Button{"toggle-browser", "Browse"}
+	UseFolderButton     = Button{"use-folder", "Use Folder"}
+	ParentFolderButton  = Button{"parent-folder", "Parent"}
+	CloseBrowserButton  = Button{"close-browser", "Close"}
+)
+
+// browserLines is how many folders are shown at once.
+const browserLines = 8
+
+// thisFolder is the first entry of the browser, picking it uses the browsed
+// folder itself.
+const thisFolder = "."
+
+// folderBrowser walks the folders from the keyboard in place of the
+// warnings, typing filters the folders.
+type folderBrowser struct {
+	open    bool
+	loading bool
+	dir     string
+	folders []string
+	err     error
+	filter  string
+	cursor  int
+	// focus is the folder to select once dir is read, the one left when
+	// going to the parent
+	focus string
+	// pickErr is why the picked folder can't be used, the warnings are
+	// hidden while browsing
+	pickErr error
+}
+
+type BrowseMsg struct {
+	dir     string
+	folders []string
+	err     error
+}
+
+func FetchFolders(dir string) tea.Cmd {
+	return func() tea.Msg {
+		folders, err := listFolders(dir)
+		return BrowseMsg{dir, folders, err}
+	}
+}
+
+// toggle opens the browser on a folder, or closes it.
+func (b *folderBrowser) toggle(dir string) tea.Cmd {
+	b.open = !b.open
+	if !b.open {
+		return nil
+	}
+	return b.browse(dir, "")
+}
+
+func (b *folderBrowser) browse(dir, focus string) tea.Cmd {
+	b.dir, b.focus, b.filter, b.cursor = dir, focus, "", 0
+	b.folders, b.err, b.loading = nil, nil, true
+	return FetchFolders(dir)
+}
+
+// update stores the folders, unless another folder was browsed to since.
+func (b *folderBrowser) update(msg BrowseMsg) {
+	if msg.dir != b.dir {
+		return
+	}
+	b.folders, b.err, b.loading = msg.folders, msg.err, false
+	for i, name := range b.entries() {
+		if name == b.focus {
+			b.cursor = i
+		}
+	}
+}
+
+// entries are the folders matching the filter, best matches first, and the
+// browsed folder itself while there's no filter.
+func (b *folderBrowser) entries() []string {
+	if b.filter == "" {
+		return append([]string{thisFolder}, b.folders...)
+	}
+	return fuzzyFilter(b.folders, b.filter)
+}
+
+// selected returns the path of the entry under the cursor, empty if none.
+func (b *folderBrowser) selected() string {
+	entries := b.entries()
+	if b.cursor >= len(entries) {
+		return ""
+	}
+	if entries[b.cursor] == thisFolder {
+		return b.dir
+	}
+	return filepath.Join(b.dir, entries[b.cursor])
+}
+
+// enter browses the folder under the cursor.
+func (b *folderBrowser) enter() tea.Cmd {
+	path := b.selected()
+	if path == "" || path == b.dir {
+		return nil
+	}
+	return b.browse(path, "")
+}
+
+func (b *folderBrowser) parent() tea.Cmd {
+	parent := filepath.Dir(b.dir)
+	if parent == b.dir {
+		return nil
+	}
+	return b.browse(parent, filepath.Base(b.dir))
+}
+
+// handleKey reacts to the browser keys, false if the key isn't one of them.
+// Enter picks the folder under the cursor.
+func (b *folderBrowser) handleKey(msg tea.KeyMsg) (tea.Cmd, bool) {
+	b.pickErr = nil
+	switch msg.Type {
+	case tea.KeyUp:
+		b.cursor = max(b.cursor-1, 0)
+	case tea.KeyDown:
+		b.cursor = max(min(b.cursor+1, len(b.entries())-1), 0)
+	case tea.KeyRight, tea.KeyTab:
+		return b.enter(), true
+	case tea.KeyLeft:
+		return b.parent(), true
+	case tea.KeyBackspace:
+		if b.filter == "" {
+			return b.parent(), true
+		}
+		_, size := utf8.DecodeLastRuneInString(b.filter)
+		b.filter, b.cursor = b.filter[:len(b.filter)-size], 0
+	case tea.KeyEnter:
+		if path := b.selected(); path != "" {
+			return CheckFolder(path), true
+		}
+	case tea.KeyEsc:
+		// clears the filter first, rather than quitting
+		if b.filter != "" {
+			b.filter, b.cursor = "", 0
+		} else {
+			b.open = false
+		}
+	case tea.KeyRunes, tea.KeySpace:
+		b.filter, b.cursor = b.filter+string(msg.Runes), 0
+	default:
+		return nil, false
+	}
+	return nil, true
+}
+
+// handleClick selects the clicked folder, or browses it if it was already
+// selected, false if none was clicked.
+func (b *folderBrowser) handleClick(msg tea.MouseMsg) (tea.Cmd, bool) {
+	for i := range b.entries() {
+		if zone.Get(fmt.Sprintf("folder-%d", i)).InBounds(msg) {
+			if b.cursor == i {
+				return b.enter(), true
+			}
+			b.cursor = i
+			return nil, true
+		}
+	}
+	return nil, false
+}
+
+func (b *folderBrowser) title() string {
+	title := "Browse | "
+	// keeps the end of long paths, the divider is 62 wide
+	dir := []rune(b.dir)
+	if room := 50 - len(title); len(dir) > room {
+		dir = append([]rune("…"), dir[len(dir)-room+1:]...)
+	}
+	return title + string(dir)
+}
+
+func (b *folderBrowser) view() string {
+	style := lipgloss.NewStyle().Foreground(lipgloss.Color("#949494")).PaddingLeft(2).MaxWidth(64)
+	lines := []string{}
+	if b.pickErr != nil {
+		lines = append(lines, style.Foreground(lipgloss.Color("#FF5F5F")).Render(b.pickErr.Error()))
+	}
+	if b.filter != "" {
+		lines = append(lines, style.Render("filter: "+b.filter))
+	}
+	switch {
+	case b.err != nil:
+		return lipgloss.JoinVertical(lipgloss.Left, append(lines, style.Render(b.err.Error()))...)
+	case b.loading:
+		return lipgloss.JoinVertical(lipgloss.Left, append(lines, style.Render("reading..."))...)
+	}
+
+	entries := b.entries()
+	if len(entries) == 0 {
+		return lipgloss.JoinVertical(lipgloss.Left, append(lines, style.Render("no matching folder"))...)
+	}
+	start := max(min(b.cursor-browserLines/2, len(entries)-browserLines), 0)
+	end := min(start+browserLines, len(entries))
+	for i := start; i < end; i++ {
+		prefix := "  "
+		if i == b.cursor {
+			prefix = "> "
+		}
+		name := entries[i] + string(filepath.Separator)
+		if entries[i] == thisFolder {
+			name = "(this folder)"
+		}
+		lineStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#949494")).MaxWidth(62)
+		if i == b.cursor {
+			lineStyle = lineStyle.Foreground(lipgloss.Color("#FFF7DB")).Bold(true)
+		}
+		lines = append(lines, zone.Mark(fmt.Sprintf("folder-%d", i), lineStyle.Render(prefix+name)))
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
+
+// fuzzyFilter keeps the names holding the letters of the filter in order,
+// whatever the case. Names starting with the filter come first, then the
+// ones containing it, then the rest.
+func fuzzyFilter(names []string, filter string) []string {
+	filter = strings.ToLower(filter)
+	type match struct {
+		name string
+		rank int
+	}
+	matches := []match{}
+	for _, name := range names {
+		lower := strings.ToLower(name)
+		switch {
+		case strings.HasPrefix(lower, filter):
+			matches = append(matches, match{name, 0})
+		case strings.Contains(lower, filter):
+			matches = append(matches, match{name, 1})
+		case isSubsequence(filter, lower):
+			matches = append(matches, match{name, 2})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].rank < matches[j].rank })
+
+	filtered := []string{}
+	for _, m := range matches {
+		filtered = append(filtered, m.name)
+	}
+	return filtered
+}
+
+func isSubsequence(sub, s string) bool {
+	for _, r := range s {
+		if sub == "" {
+			break
+		}
+		if first, size := utf8.DecodeRuneInString(sub); first == r {
+			sub = sub[size:]
+		}
+	}
+	return sub == ""
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"exputils/imageinfo"
+	"exputils/utils"
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ToggleFolderInfoButton is the divider of the folder panel, clicking it
+// expands or collapses the panel.
+var ToggleFolderInfoButton = Button{"toggle-folder-info", "Folder"}
+
+// folderInfo is the panel summing up the images of the current folder.
+type folderInfo struct {
+	path     string
+	summary  imageinfo.Summary
+	err      error
+	loading  bool
+	expanded bool
+}
+
+type FolderInfoMsg struct {
+	path    string
+	summary imageinfo.Summary
+	err     error
+}
+
+// FetchFolderInfo reads the headers of the files of the folder, in the
+// background like every tea.Cmd.
+func FetchFolderInfo(path string) tea.Cmd {
+	return func() tea.Msg {
+		summary, err := imageinfo.Summarize(path)
+		return FolderInfoMsg{path, summary, err}
+	}
+}
+
+// refresh marks the panel as loading and returns the command reading the
+// folder, nil when there's no folder yet.
+func (f *folderInfo) refresh(path string) tea.Cmd {
+	if path == "" {
+		return nil
+	}
+	f.path = path
+	f.loading = true
+	return FetchFolderInfo(path)
+}
+
+// update stores the summary, unless the folder changed since it was asked for.
+func (f *folderInfo) update(msg FolderInfoMsg) {
+	if msg.path != f.path {
+		return
+	}
+	f.summary, f.err, f.loading = msg.summary, msg.err, false
+}
+
+func (f *folderInfo) title() string {
+	arrow := "▸"
+	if f.expanded {
+		arrow = "▾"
+	}
+	switch {
+	case f.path == "":
+		return arrow + " Folder"
+	case f.loading:
+		return arrow + " Folder | reading..."
+	case f.err != nil:
+		return arrow + " Folder | unreadable"
+	}
+	return fmt.Sprintf("%s Folder | %d files, %s", arrow, f.summary.Files(), utils.FormatBytes(f.summary.Size()))
+}
+
+func (f *folderInfo) view() string {
+	dim := lipgloss.NewStyle().Foreground(lipgloss.Color("#949494")).PaddingLeft(2).MaxWidth(64)
+	bright := dim.Foreground(lipgloss.Color("#FFF7DB"))
+
+	switch {
+	case f.path == "":
+		return dim.Render("no folder yet")
+	case f.loading && f.summary.Files() == 0:
+		return dim.Render("reading...")
+	case f.err != nil:
+		return dim.Render(f.err.Error())
+	}
+
+	if !f.expanded {
+		counts := []string{}
+		for _, format := range f.summary.Formats {
+			counts = append(counts, fmt.Sprintf("%d %s", format.Count, format.Format))
+		}
+		if f.summary.Other > 0 {
+			counts = append(counts, fmt.Sprintf("%d other", f.summary.Other))
+		}
+		if len(counts) == 0 {
+			return dim.Render("no files")
+		}
+		return dim.Render(strings.Join(counts, ", "))
+	}
+
+	lines := []string{}
+	for _, format := range f.summary.Formats {
+		dimensions := ""
+		if format.Largest.Width > 0 {
+			smallest := fmt.Sprintf("%dx%d", format.Smallest.Width, format.Smallest.Height)
+			largest := fmt.Sprintf("%dx%d", format.Largest.Width, format.Largest.Height)
+			dimensions = largest
+			if smallest != largest {
+				dimensions = smallest + " - " + largest
+			}
+		}
+		lines = append(lines, bright.Render(fmt.Sprintf(
+			"%-5s %5d  %10s  %s", format.Format, format.Count, utils.FormatBytes(format.Size), dimensions,
+		)))
+
+		traits := []string{}
+		for _, trait := range format.SortedTraits() {
+			traits = append(traits, fmt.Sprintf("%s %d", trait, format.Traits[trait]))
+		}
+		if len(traits) > 0 {
+			lines = append(lines, dim.Render("      "+strings.Join(traits, ", ")))
+		}
+	}
+	if f.summary.Other > 0 {
+		lines = append(lines, dim.Render(fmt.Sprintf(
+			"%-5s %5d  %10s", "other", f.summary.Other, utils.FormatBytes(f.summary.OtherSize),
+		)))
+	}
+	if len(lines) == 0 {
+		return dim.Render("no files")
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
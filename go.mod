@@ -1,6 +1,6 @@
 module exputils
 
-go 1.21
+go 1.22
 
 toolchain go1.23.6
 
@@ -9,11 +9,14 @@ require (
 	github.com/charmbracelet/bubbletea v1.3.3
 	github.com/charmbracelet/lipgloss v1.0.0
 	github.com/go-ole/go-ole v1.2.6
+	github.com/godbus/dbus/v5 v5.1.0
 	github.com/lrstanley/bubblezone v0.0.0-20250208020128-be525e7e10ed
+	golang.org/x/crypto v0.33.0
 	golang.org/x/sys v0.30.0
 )
 
 require (
+	github.com/atotto/clipboard v0.1.4 // indirect
 	github.com/aymanbagabas/go-osc52/v2 v2.0.1 // indirect
 	github.com/charmbracelet/harmonica v0.2.0 // indirect
 	github.com/charmbracelet/x/ansi v0.8.0 // indirect
@@ -0,0 +1,149 @@
+// Package history keeps the finished task runs, with their options and
+// results, as JSON lines in a single file.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"exputils/config"
+	"exputils/report"
+	"exputils/utils"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// maxRuns is how many runs the file keeps, the oldest go first.
+const maxRuns = 500
+
+type Outcome string
+
+const (
+	OutcomeOK       Outcome = "ok"
+	OutcomeWarnings Outcome = "warnings"
+	OutcomeFailed   Outcome = "failed"
+	OutcomeCanceled Outcome = "canceled"
+)
+
+// OutcomeOf sums up a run: canceled, failed if any file failed, with warnings
+// if it reported anything not about a single file.
+func OutcomeOf(r report.Report) Outcome {
+	switch {
+	case r.Canceled:
+		return OutcomeCanceled
+	case r.Totals.Failed > 0:
+		return OutcomeFailed
+	case r.Totals.Messages > 0:
+		return OutcomeWarnings
+	}
+	return OutcomeOK
+}
+
+// Run is a finished run, enough to show its results and run it again.
+type Run struct {
+	report.Report
+	// Options are the options the task ran with, profile and config merged.
+	Options map[string]string `json:"options,omitempty"`
+	// LogPath is the run log, empty if the run wasn't logged.
+	LogPath string  `json:"logPath,omitempty"`
+	Outcome Outcome `json:"outcome"`
+}
+
+// Path returns the path of the history file.
+func Path() (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history.jsonl"), nil
+}
+
+var mutex sync.Mutex
+
+// Append adds a run at the end of the file, dropping the oldest ones past
+// maxRuns.
+func Append(path string, run Run) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("can't create history directory: %w", err)
+	}
+	lines, err := readLines(path)
+	if err != nil {
+		return err
+	}
+	lines = append(lines, data)
+	if len(lines) > maxRuns {
+		lines = lines[len(lines)-maxRuns:]
+	}
+	if err := utils.WriteFileAtomic(path, append(bytes.Join(lines, []byte("\n")), '\n'), 0o644); err != nil {
+		return fmt.Errorf("can't write history: %w", err)
+	}
+	return nil
+}
+
+func readLines(path string) ([][]byte, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("can't read history: %w", err)
+	}
+	defer file.Close()
+
+	lines := [][]byte{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			lines = append(lines, append([]byte{}, line...))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("can't read history: %w", err)
+	}
+	return lines, nil
+}
+
+// Load returns the runs of the file, newest first. Lines that can't be parsed
+// are skipped.
+func Load(path string) ([]Run, error) {
+	mutex.Lock()
+	lines, err := readLines(path)
+	mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	runs := []Run{}
+	for i := len(lines) - 1; i >= 0; i-- {
+		var run Run
+		if err := json.Unmarshal(lines[i], &run); err != nil {
+			continue
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// LastByFolder returns the newest run of each folder, runs being newest
+// first like Load returns them.
+func LastByFolder(runs []Run) map[string]Run {
+	last := map[string]Run{}
+	for _, run := range runs {
+		folder := filepath.Clean(run.Folder)
+		if _, ok := last[folder]; !ok {
+			last[folder] = run
+		}
+	}
+	return last
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"exputils/history"
+	"exputils/utils"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	zone "github.com/lrstanley/bubblezone"
+)
+
+var (
+	// ToggleHistoryButton is the divider of the warnings, or of the history
+	// when it's open, clicking it switches between both.
+	ToggleHistoryButton = Button{"toggle-history", "History"}
+	RerunButton         = Button{"rerun", "Re-run"}
+	OpenRunLogButton    = Button{"open-run-log", "Open Run Log"}
+	CloseHistoryButton  = Button{"close-history", "Close"}
+)
+
+// historyLines is how many lines of the history are shown at once.
+const historyLines = 8
+
+var outcomeColors = map[history.Outcome]lipgloss.Color{
+	history.OutcomeOK:       "#949494",
+	history.OutcomeWarnings: "#FFD75F",
+	history.OutcomeFailed:   "#FF5F5F",
+	history.OutcomeCanceled: "#666565",
+}
+
+// historyScreen lists the past runs in place of the warnings, and shows the
+// results of the selected one.
+type historyScreen struct {
+	open    bool
+	loading bool
+	runs    []history.Run
+	err     error
+	cursor  int
+	// details shows the results of the selected run instead of the list,
+	// scrolled by offset
+	details bool
+	offset  int
+}
+
+type HistoryMsg struct {
+	runs []history.Run
+	err  error
+}
+
+func FetchHistory() tea.Msg {
+	path, err := history.Path()
+	if err != nil {
+		return HistoryMsg{nil, err}
+	}
+	runs, err := history.Load(path)
+	return HistoryMsg{runs, err}
+}
+
+// toggle opens or closes the screen, it reloads the history when opened.
+func (h *historyScreen) toggle() tea.Cmd {
+	h.open, h.details = !h.open, false
+	if !h.open {
+		return nil
+	}
+	h.loading = true
+	return FetchHistory
+}
+
+// refresh reloads the history if the screen is open.
+func (h *historyScreen) refresh() tea.Cmd {
+	if !h.open {
+		return nil
+	}
+	return FetchHistory
+}
+
+func (h *historyScreen) update(msg HistoryMsg) {
+	h.runs, h.err, h.loading = msg.runs, msg.err, false
+	h.cursor = max(min(h.cursor, len(h.runs)-1), 0)
+}
+
+func (h *historyScreen) selected() (history.Run, bool) {
+	if h.cursor >= len(h.runs) {
+		return history.Run{}, false
+	}
+	return h.runs[h.cursor], true
+}
+
+// handleKey reacts to the history keys, false if the key isn't one of them.
+func (h *historyScreen) handleKey(msg tea.KeyMsg) bool {
+	switch msg.String() {
+	case "up":
+		if h.details {
+			h.offset = max(h.offset-1, 0)
+		} else {
+			h.cursor = max(h.cursor-1, 0)
+		}
+	case "down":
+		if h.details {
+			h.offset = min(h.offset+1, max(len(h.detailLines())-historyLines, 0))
+		} else {
+			h.cursor = max(min(h.cursor+1, len(h.runs)-1), 0)
+		}
+	case " ", "enter":
+		h.details, h.offset = !h.details && len(h.runs) > 0, 0
+	case "backspace":
+		h.details = false
+	case "esc":
+		// back to the list, or to the warnings, rather than quitting
+		if h.details {
+			h.details = false
+		} else {
+			h.open = false
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// handleClick selects the clicked run, or shows its results if it was
+// already selected, false if none was clicked.
+func (h *historyScreen) handleClick(msg tea.MouseMsg) bool {
+	if h.details {
+		return false
+	}
+	for i := range h.runs {
+		if zone.Get(fmt.Sprintf("run-%d", i)).InBounds(msg) {
+			if h.cursor == i {
+				h.details, h.offset = true, 0
+			}
+			h.cursor = i
+			return true
+		}
+	}
+	return false
+}
+
+func (h *historyScreen) title() string {
+	if h.details {
+		return "History | Results"
+	}
+	return fmt.Sprintf("History | %d runs", len(h.runs))
+}
+
+// runLine is the line of a run in the list.
+func runLine(run history.Run) string {
+	return fmt.Sprintf(
+		"%s  %s  %s  %d files, %s",
+		run.Started.Format("01-02 15:04"), run.TaskID, filepath.Base(run.Folder), run.Totals.Files, run.Outcome,
+	)
+}
+
+// detailLines are the results of the selected run.
+func (h *historyScreen) detailLines() []string {
+	run, ok := h.selected()
+	if !ok {
+		return nil
+	}
+	lines := []string{
+		fmt.Sprintf("%s on %s", run.TaskID, run.Folder),
+		fmt.Sprintf(
+			"%s, took %s, %s",
+			run.Started.Format("2006-01-02 15:04:05"), run.Ended.Sub(run.Started).Round(time.Second), run.Outcome,
+		),
+	}
+
+	counts := []string{}
+	for status, count := range run.Totals.ByStatus {
+		counts = append(counts, fmt.Sprintf("%d %s", count, status))
+	}
+	sort.Strings(counts)
+	if len(counts) > 0 {
+		lines = append(lines, fmt.Sprintf(
+			"%s, %s -> %s",
+			strings.Join(counts, ", "), utils.FormatBytes(run.Totals.InputSize), utils.FormatBytes(run.Totals.OutputSize),
+		))
+	}
+	if len(run.Options) > 0 {
+		options := []string{}
+		for key, value := range run.Options {
+			options = append(options, key+"="+value)
+		}
+		sort.Strings(options)
+		lines = append(lines, "options: "+strings.Join(options, ", "))
+	}
+
+	for _, row := range run.Files {
+		line := fmt.Sprintf("[%s] %s", row.Status, row.Input)
+		if row.Output != "" {
+			line += " -> " + row.Output
+		}
+		if row.Message != "" {
+			line += ": " + row.Message
+		}
+		lines = append(lines, line)
+	}
+	for _, message := range run.Messages {
+		lines = append(lines, "- "+message)
+	}
+	return lines
+}
+
+func (h *historyScreen) view() string {
+	style := lipgloss.NewStyle().Foreground(lipgloss.Color("#949494")).PaddingLeft(2).MaxWidth(64)
+	switch {
+	case h.err != nil:
+		return style.Render(h.err.Error())
+	case h.loading:
+		return style.Render("loading...")
+	case len(h.runs) == 0:
+		return style.Render("no runs yet")
+	}
+
+	if h.details {
+		lines := h.detailLines()
+		end := min(h.offset+historyLines, len(lines))
+		for i := h.offset; i < end; i++ {
+			lines[i] = style.Render(lines[i])
+		}
+		return lipgloss.JoinVertical(lipgloss.Left, lines[h.offset:end]...)
+	}
+
+	lines := []string{}
+	start := max(min(h.cursor-historyLines/2, len(h.runs)-historyLines), 0)
+	end := min(start+historyLines, len(h.runs))
+	for i := start; i < end; i++ {
+		prefix := "  "
+		if i == h.cursor {
+			prefix = "> "
+		}
+		lineStyle := lipgloss.NewStyle().Foreground(outcomeColors[h.runs[i].Outcome]).MaxWidth(62)
+		if i == h.cursor {
+			lineStyle = lineStyle.Bold(true)
+		}
+		lines = append(lines, zone.Mark(fmt.Sprintf("run-%d", i), lineStyle.Render(prefix+runLine(h.runs[i]))))
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
+
+// buttonOfTask returns the button of a registered task, nil if there's none,
+// like for the runs resolving duplicates.
+func buttonOfTask(taskID string) *Button {
+	for _, button := range taskButtons {
+		if button.ID == taskID {
+			return button
+		}
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package imageinfo
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+)
+
+// readGIF reads the logical screen descriptor, GIFs are always 8-bit
+// palette images.
+func readGIF(r *bufio.Reader, info *Info) error {
+	var header [10]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return err
+	}
+	info.Width = int(binary.LittleEndian.Uint16(header[6:8]))
+	info.Height = int(binary.LittleEndian.Uint16(header[8:10]))
+	info.BitDepth = 8
+	info.Color = ColorPalette
+	return nil
+}
@@ -0,0 +1,141 @@
+// Package imageinfo reads what an image is made of from its header, without
+// decoding the pixels.
+package imageinfo
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"exputils/jxl"
+	"fmt"
+	"io"
+	"os"
+)
+
+type Format string
+
+const (
+	FormatJPEG Format = "JPEG"
+	FormatPNG  Format = "PNG"
+	FormatJXL  Format = "JXL"
+	FormatGIF  Format = "GIF"
+	FormatWebP Format = "WebP"
+)
+
+type Color string
+
+const (
+	ColorGray      Color = "gray"
+	ColorGrayAlpha Color = "gray+alpha"
+	ColorRGB       Color = "RGB"
+	ColorRGBA      Color = "RGBA"
+	ColorPalette   Color = "palette"
+	ColorCMYK      Color = "CMYK"
+)
+
+// Info is what the header of an image tells, fields the format doesn't
+// store are left zero.
+type Info struct {
+	Format        Format
+	Width, Height int
+	// BitDepth is the number of bits per sample.
+	BitDepth int
+	Color    Color
+
+	Progressive bool
+	Animated    bool
+	// ICC is set when the image embeds an ICC profile.
+	ICC bool
+	// JPEGReconstruction is set for JXL files that can be decoded back to
+	// the JPEG they were made from.
+	JPEGReconstruction bool
+}
+
+// ErrUnknownFormat is returned for files that aren't images of a known format.
+var ErrUnknownFormat = errors.New("unknown image format")
+
+var (
+	jpegMagic          = []byte{0xFF, 0xD8, 0xFF}
+	pngMagic           = []byte("\x89PNG\r\n\x1a\n")
+	jxlCodestreamMagic = []byte{0xFF, 0x0A}
+	jxlContainerMagic  = []byte("\x00\x00\x00\x0cJXL \r\n\x87\n")
+)
+
+// Sniff returns the format of an image from its first bytes.
+func Sniff(head []byte) (Format, bool) {
+	switch {
+	case bytes.HasPrefix(head, jpegMagic):
+		return FormatJPEG, true
+	case bytes.HasPrefix(head, pngMagic):
+		return FormatPNG, true
+	case bytes.HasPrefix(head, jxlCodestreamMagic), bytes.HasPrefix(head, jxlContainerMagic):
+		return FormatJXL, true
+	case bytes.HasPrefix(head, []byte("GIF87a")), bytes.HasPrefix(head, []byte("GIF89a")):
+		return FormatGIF, true
+	case len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "WEBP":
+		return FormatWebP, true
+	}
+	return "", false
+}
+
+// Read reads the header of an image file. The format is always set when the
+// file is a known format, even if reading its header fails.
+func Read(path string) (Info, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Info{}, err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	head, err := r.Peek(16)
+	if err != nil && err != io.EOF {
+		return Info{}, err
+	}
+	format, ok := Sniff(head)
+	if !ok {
+		return Info{}, ErrUnknownFormat
+	}
+
+	info := Info{Format: format}
+	switch format {
+	case FormatJPEG:
+		err = readJPEG(r, &info)
+	case FormatPNG:
+		err = readPNG(r, &info)
+	case FormatJXL:
+		if _, err = file.Seek(0, io.SeekStart); err == nil {
+			err = readJXL(file, &info)
+		}
+	case FormatGIF:
+		err = readGIF(r, &info)
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		err = fmt.Errorf("truncated %s header", format)
+	}
+	return info, err
+}
+
+// readJXL reads the container boxes and the codestream header.
+func readJXL(r io.ReadSeeker, info *Info) error {
+	f, err := jxl.Read(r)
+	if err != nil {
+		return err
+	}
+	info.Width, info.Height = f.Header.Width, f.Header.Height
+	info.BitDepth = f.Header.BitsPerSample
+	switch {
+	case f.Header.Grayscale && f.Header.Alpha:
+		info.Color = ColorGrayAlpha
+	case f.Header.Grayscale:
+		info.Color = ColorGray
+	case f.Header.Alpha:
+		info.Color = ColorRGBA
+	default:
+		info.Color = ColorRGB
+	}
+	info.Animated = f.Header.Animated
+	info.ICC = f.Header.WantICC
+	info.JPEGReconstruction = f.JPEGReconstruction
+	return nil
+}
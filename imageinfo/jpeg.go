@@ -0,0 +1,128 @@
+package imageinfo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// JPEG markers, see ITU T.81 table B.1.
+const (
+	markerSOF0  = 0xC0
+	markerSOF15 = 0xCF
+	markerDHT   = 0xC4
+	markerJPG   = 0xC8
+	markerDAC   = 0xCC
+	markerRST0  = 0xD0
+	markerRST7  = 0xD7
+	markerSOI   = 0xD8
+	markerEOI   = 0xD9
+	markerSOS   = 0xDA
+	markerAPP2  = 0xE2
+	markerTEM   = 0x01
+)
+
+// readJPEG walks the marker segments up to the first scan. The frame header
+// gives the size, precision and components, APP2 the ICC profile.
+func readJPEG(r *bufio.Reader, info *Info) error {
+	if _, err := r.Discard(2); err != nil {
+		return err
+	}
+
+	components := 0
+	for {
+		marker, err := nextMarker(r)
+		if err != nil {
+			return err
+		}
+		switch {
+		case marker == markerSOI || marker == markerTEM || (marker >= markerRST0 && marker <= markerRST7):
+			continue // no length
+		case marker == markerEOI:
+			return fmt.Errorf("no frame header")
+		}
+
+		var length uint16
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+			return err
+		}
+		if length < 2 {
+			return fmt.Errorf("invalid segment length %d", length)
+		}
+		size := int(length) - 2
+
+		switch {
+		case marker == markerSOS:
+			if components == 0 {
+				return fmt.Errorf("scan before frame header")
+			}
+			// colour JPEGs store YCbCr or YCCK, they're reported as what they
+			// decode to
+			switch components {
+			case 1:
+				info.Color = ColorGray
+			case 3:
+				info.Color = ColorRGB
+			case 4:
+				info.Color = ColorCMYK
+			}
+			return nil
+
+		case isSOF(marker):
+			var sof [6]byte
+			if size < len(sof) {
+				return fmt.Errorf("frame header too short")
+			}
+			if _, err := io.ReadFull(r, sof[:]); err != nil {
+				return err
+			}
+			info.BitDepth = int(sof[0])
+			info.Height = int(binary.BigEndian.Uint16(sof[1:3]))
+			info.Width = int(binary.BigEndian.Uint16(sof[3:5]))
+			components = int(sof[5])
+			// SOF2, SOF6, SOF10 and SOF14 are the progressive modes
+			info.Progressive = (marker-markerSOF0)&0x3 == 2
+			size -= len(sof)
+
+		case marker == markerAPP2:
+			// the profile can be split over several segments, the first
+			// one is enough
+			iccSignature := []byte("ICC_PROFILE\x00")
+			if size >= len(iccSignature) {
+				signature, err := r.Peek(len(iccSignature))
+				if err != nil {
+					return err
+				}
+				info.ICC = info.ICC || bytes.Equal(signature, iccSignature)
+			}
+		}
+
+		if _, err := r.Discard(size); err != nil {
+			return err
+		}
+	}
+}
+
+// nextMarker skips to the next marker, fill bytes included.
+func nextMarker(r *bufio.Reader) (byte, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b != 0xFF {
+		return 0, fmt.Errorf("expected marker, got 0x%02X", b)
+	}
+	for b == 0xFF {
+		if b, err = r.ReadByte(); err != nil {
+			return 0, err
+		}
+	}
+	return b, nil
+}
+
+func isSOF(marker byte) bool {
+	return marker >= markerSOF0 && marker <= markerSOF15 &&
+		marker != markerDHT && marker != markerJPG && marker != markerDAC
+}
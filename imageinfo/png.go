@@ -0,0 +1,69 @@
+package imageinfo
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// readPNG reads IHDR, then the chunks before the image data: acTL makes an
+// animated PNG and iCCP holds an ICC profile.
+func readPNG(r *bufio.Reader, info *Info) error {
+	if _, err := r.Discard(len(pngMagic)); err != nil {
+		return err
+	}
+
+	for first := true; ; first = false {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return err
+		}
+		length := int(binary.BigEndian.Uint32(header[:4]))
+		chunkType := string(header[4:])
+		if first && chunkType != "IHDR" {
+			return fmt.Errorf("first chunk is '%s', not IHDR", chunkType)
+		}
+
+		switch chunkType {
+		case "IHDR":
+			var ihdr [13]byte
+			if length != len(ihdr) {
+				return fmt.Errorf("invalid IHDR length %d", length)
+			}
+			if _, err := io.ReadFull(r, ihdr[:]); err != nil {
+				return err
+			}
+			length = 0
+			info.Width = int(binary.BigEndian.Uint32(ihdr[0:4]))
+			info.Height = int(binary.BigEndian.Uint32(ihdr[4:8]))
+			info.BitDepth = int(ihdr[8])
+			switch ihdr[9] {
+			case 0:
+				info.Color = ColorGray
+			case 2:
+				info.Color = ColorRGB
+			case 3:
+				info.Color = ColorPalette
+			case 4:
+				info.Color = ColorGrayAlpha
+			case 6:
+				info.Color = ColorRGBA
+			default:
+				return fmt.Errorf("invalid color type %d", ihdr[9])
+			}
+			info.Progressive = ihdr[12] == 1 // Adam7 interlacing
+		case "acTL":
+			info.Animated = true
+		case "iCCP":
+			info.ICC = true
+		case "IDAT", "IEND":
+			return nil
+		}
+
+		// chunk data then CRC
+		if _, err := r.Discard(length + 4); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package imageinfo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// extensions lists the usual extensions of each format, a file with another
+// one is counted as misnamed.
+var extensions = map[Format][]string{
+	FormatJPEG: {".jpg", ".jpeg", ".jfif", ".jpe"},
+	FormatPNG:  {".png", ".apng"},
+	FormatJXL:  {".jxl"},
+	FormatGIF:  {".gif"},
+	FormatWebP: {".webp"},
+}
+
+// FormatSummary sums up the images of one format in a folder.
+type FormatSummary struct {
+	Format Format
+	Count  int
+	Size   int64
+	// Smallest and Largest are the images with the fewest and most pixels.
+	Smallest, Largest Info
+	// Traits counts the images by trait, like "progressive" or "ICC".
+	Traits map[string]int
+}
+
+// Summary sums up the files of a folder by their real format.
+type Summary struct {
+	Formats []FormatSummary
+	// Other counts the files that aren't images of a known format.
+	Other     int
+	OtherSize int64
+}
+
+func (s Summary) Files() int {
+	count := s.Other
+	for _, f := range s.Formats {
+		count += f.Count
+	}
+	return count
+}
+
+func (s Summary) Size() int64 {
+	size := s.OtherSize
+	for _, f := range s.Formats {
+		size += f.Size
+	}
+	return size
+}
+
+// SortedTraits returns the traits ordered by count, then name.
+func (f FormatSummary) SortedTraits() []string {
+	traits := make([]string, 0, len(f.Traits))
+	for trait := range f.Traits {
+		traits = append(traits, trait)
+	}
+	sort.Slice(traits, func(i, j int) bool {
+		if f.Traits[traits[i]] != f.Traits[traits[j]] {
+			return f.Traits[traits[i]] > f.Traits[traits[j]]
+		}
+		return traits[i] < traits[j]
+	})
+	return traits
+}
+
+// traits lists what's worth counting about an image.
+func traits(info Info, fileName string) []string {
+	result := []string{}
+	if info.Color != "" {
+		result = append(result, string(info.Color))
+	}
+	if info.BitDepth != 0 && info.BitDepth != 8 {
+		result = append(result, fmt.Sprintf("%d-bit", info.BitDepth))
+	}
+	if info.Progressive {
+		if info.Format == FormatPNG {
+			result = append(result, "interlaced")
+		} else {
+			result = append(result, "progressive")
+		}
+	}
+	if info.Animated {
+		result = append(result, "animated")
+	}
+	if info.ICC {
+		result = append(result, "ICC")
+	}
+	if info.JPEGReconstruction {
+		result = append(result, "JPEG reconstruction")
+	}
+	ext := strings.ToLower(filepath.Ext(fileName))
+	found := false
+	for _, e := range extensions[info.Format] {
+		found = found || e == ext
+	}
+	if !found {
+		result = append(result, "misnamed")
+	}
+	return result
+}
+
+// Summarize reads the header of every file in the folder, subfolders are
+// left out.
+func Summarize(dir string) (Summary, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return Summary{}, fmt.Errorf("can't read directory: %w", err)
+	}
+
+	summary := Summary{}
+	byFormat := map[Format]*FormatSummary{}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		fileInfo, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		info, err := Read(filepath.Join(dir, entry.Name()))
+		if info.Format == "" {
+			summary.Other++
+			summary.OtherSize += fileInfo.Size()
+			continue
+		}
+
+		f, ok := byFormat[info.Format]
+		if !ok {
+			f = &FormatSummary{Format: info.Format, Smallest: info, Largest: info, Traits: map[string]int{}}
+			byFormat[info.Format] = f
+		}
+		f.Count++
+		f.Size += fileInfo.Size()
+		if err != nil {
+			f.Traits["unreadable"]++
+			continue
+		}
+		if pixels := info.Width * info.Height; pixels > 0 {
+			if pixels < f.Smallest.Width*f.Smallest.Height || f.Smallest.Width == 0 {
+				f.Smallest = info
+			}
+			if pixels > f.Largest.Width*f.Largest.Height {
+				f.Largest = info
+			}
+		}
+		for _, trait := range traits(info, entry.Name()) {
+			f.Traits[trait]++
+		}
+	}
+
+	for _, f := range byFormat {
+		summary.Formats = append(summary.Formats, *f)
+	}
+	sort.Slice(summary.Formats, func(i, j int) bool {
+		if summary.Formats[i].Count != summary.Formats[j].Count {
+			return summary.Formats[i].Count > summary.Formats[j].Count
+		}
+		return summary.Formats[i].Format < summary.Formats[j].Format
+	})
+	return summary, nil
+}
@@ -0,0 +1,297 @@
+package jxl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Header is the start of the codestream: the image size and metadata.
+type Header struct {
+	Width, Height int
+
+	// BitsPerSample is the bit depth of the original image, FloatSamples
+	// tells whether its samples were floats.
+	BitsPerSample int
+	FloatSamples  bool
+
+	Grayscale bool
+	Alpha     bool
+	Animated  bool
+	// WantICC is set when the codestream embeds an ICC profile.
+	WantICC bool
+	// XYBEncoded is set for lossy images, lossless ones keep the original
+	// colour space.
+	XYBEncoded bool
+	// Orientation is the EXIF orientation, 1 to 8.
+	Orientation int
+}
+
+var errShortCodestream = errors.New("codestream header is truncated")
+
+// bitReader reads the codestream fields, least significant bit first.
+type bitReader struct {
+	data []byte
+	pos  int // in bits
+}
+
+func (b *bitReader) bits(n int) (uint64, error) {
+	if b.pos+n > len(b.data)*8 {
+		return 0, errShortCodestream
+	}
+	value := uint64(0)
+	for i := 0; i < n; i++ {
+		bit := b.data[(b.pos+i)/8] >> ((b.pos + i) % 8) & 1
+		value |= uint64(bit) << i
+	}
+	b.pos += n
+	return value, nil
+}
+
+func (b *bitReader) bool() (bool, error) {
+	v, err := b.bits(1)
+	return v == 1, err
+}
+
+// u32Dist is one of the four distributions of a U32 field: a constant when
+// bits is 0, else offset plus bits read.
+type u32Dist struct{ bits, offset int }
+
+func val(v int) u32Dist                   { return u32Dist{0, v} }
+func bitsOffset(bits, offset int) u32Dist { return u32Dist{bits, offset} }
+
+// u32 reads a 2 bits selector then the chosen distribution.
+func (b *bitReader) u32(d0, d1, d2, d3 u32Dist) (int, error) {
+	selector, err := b.bits(2)
+	if err != nil {
+		return 0, err
+	}
+	d := [4]u32Dist{d0, d1, d2, d3}[selector]
+	v, err := b.bits(d.bits)
+	return d.offset + int(v), err
+}
+
+func (b *bitReader) enum() (int, error) {
+	return b.u32(val(0), val(1), bitsOffset(4, 2), bitsOffset(6, 18))
+}
+
+// sizeHeader reads a SizeHeader, the ratio codes give the width from the
+// height.
+func (b *bitReader) sizeHeader() (int, int, error) {
+	small, err := b.bool()
+	if err != nil {
+		return 0, 0, err
+	}
+	dimension := func() (int, error) {
+		if small {
+			v, err := b.bits(5)
+			return (int(v) + 1) * 8, err
+		}
+		v, err := b.u32(bitsOffset(9, 1), bitsOffset(13, 1), bitsOffset(18, 1), bitsOffset(30, 1))
+		return v, err
+	}
+	height, err := dimension()
+	if err != nil {
+		return 0, 0, err
+	}
+	ratio, err := b.bits(3)
+	if err != nil {
+		return 0, 0, err
+	}
+	if ratio == 0 {
+		width, err := dimension()
+		return width, height, err
+	}
+	num := [8]int{0, 1, 12, 4, 3, 16, 5, 2}[ratio]
+	den := [8]int{0, 1, 10, 3, 2, 9, 4, 1}[ratio]
+	return height * num / den, height, nil
+}
+
+// previewHeader skips a PreviewHeader.
+func (b *bitReader) previewHeader() error {
+	div8, err := b.bool()
+	if err != nil {
+		return err
+	}
+	dimension := func() error {
+		if div8 {
+			_, err := b.u32(val(16), val(32), bitsOffset(5, 1), bitsOffset(9, 33))
+			return err
+		}
+		_, err := b.u32(bitsOffset(6, 1), bitsOffset(8, 65), bitsOffset(10, 321), bitsOffset(12, 1345))
+		return err
+	}
+	if err := dimension(); err != nil {
+		return err
+	}
+	ratio, err := b.bits(3)
+	if err != nil || ratio != 0 {
+		return err
+	}
+	return dimension()
+}
+
+// animationHeader skips an AnimationHeader.
+func (b *bitReader) animationHeader() error {
+	if _, err := b.u32(val(100), val(1000), bitsOffset(10, 1), bitsOffset(30, 1)); err != nil {
+		return err
+	}
+	if _, err := b.u32(val(1), val(1001), bitsOffset(8, 1), bitsOffset(10, 1)); err != nil {
+		return err
+	}
+	if _, err := b.u32(val(0), bitsOffset(3, 0), bitsOffset(16, 0), bitsOffset(32, 0)); err != nil {
+		return err
+	}
+	_, err := b.bits(1) // have_timecodes
+	return err
+}
+
+// bitDepth reads a BitDepth bundle.
+func (b *bitReader) bitDepth() (int, bool, error) {
+	float, err := b.bool()
+	if err != nil {
+		return 0, false, err
+	}
+	if !float {
+		bits, err := b.u32(val(8), val(10), val(12), bitsOffset(6, 1))
+		return bits, false, err
+	}
+	bits, err := b.u32(val(32), val(16), val(24), bitsOffset(6, 1))
+	if err != nil {
+		return 0, false, err
+	}
+	_, err = b.bits(4) // exponent bits
+	return bits, true, err
+}
+
+const (
+	extraChannelAlpha = 0
+	extraChannelSpot  = 2
+	extraChannelCFA   = 5
+
+	colorSpaceGray = 1
+)
+
+// extraChannel reads an ExtraChannelInfo and tells whether it's alpha.
+func (b *bitReader) extraChannel() (bool, error) {
+	allDefault, err := b.bool()
+	if err != nil || allDefault {
+		return true, err // the default extra channel is an alpha channel
+	}
+	channelType, err := b.enum()
+	if err != nil {
+		return false, err
+	}
+	if _, _, err := b.bitDepth(); err != nil {
+		return false, err
+	}
+	if _, err := b.u32(val(0), val(3), val(4), bitsOffset(3, 1)); err != nil { // dim_shift
+		return false, err
+	}
+	nameLength, err := b.u32(val(0), bitsOffset(4, 0), bitsOffset(5, 16), bitsOffset(10, 48))
+	if err != nil {
+		return false, err
+	}
+	for i := 0; i < nameLength; i++ {
+		if _, err := b.bits(8); err != nil {
+			return false, err
+		}
+	}
+	switch channelType {
+	case extraChannelAlpha:
+		_, err = b.bits(1) // alpha_associated
+	case extraChannelSpot:
+		_, err = b.bits(4 * 16) // red, green, blue and solidity as f16
+	case extraChannelCFA:
+		_, err = b.u32(val(1), bitsOffset(2, 0), bitsOffset(4, 3), bitsOffset(8, 19))
+	}
+	return channelType == extraChannelAlpha, err
+}
+
+// readHeader reads the SizeHeader and the ImageMetadata up to the colour
+// encoding, the fields after it aren't needed.
+func readHeader(codestream []byte) (Header, error) {
+	h := Header{BitsPerSample: 8, XYBEncoded: true, Orientation: 1}
+	if !bytes.HasPrefix(codestream, codestreamSignature) {
+		return h, fmt.Errorf("missing codestream signature")
+	}
+	b := &bitReader{data: codestream[len(codestreamSignature):]}
+
+	var err error
+	if h.Width, h.Height, err = b.sizeHeader(); err != nil {
+		return h, err
+	}
+
+	allDefault, err := b.bool()
+	if err != nil || allDefault {
+		return h, err
+	}
+
+	extraFields, err := b.bool()
+	if err != nil {
+		return h, err
+	}
+	if extraFields {
+		orientation, err := b.bits(3)
+		if err != nil {
+			return h, err
+		}
+		h.Orientation = int(orientation) + 1
+		if haveIntrinsicSize, err := b.bool(); err != nil {
+			return h, err
+		} else if haveIntrinsicSize {
+			if _, _, err := b.sizeHeader(); err != nil {
+				return h, err
+			}
+		}
+		if havePreview, err := b.bool(); err != nil {
+			return h, err
+		} else if havePreview {
+			if err := b.previewHeader(); err != nil {
+				return h, err
+			}
+		}
+		if h.Animated, err = b.bool(); err != nil {
+			return h, err
+		} else if h.Animated {
+			if err := b.animationHeader(); err != nil {
+				return h, err
+			}
+		}
+	}
+
+	if h.BitsPerSample, h.FloatSamples, err = b.bitDepth(); err != nil {
+		return h, err
+	}
+	if _, err := b.bits(1); err != nil { // modular_16_bit_buffer_sufficient
+		return h, err
+	}
+	extraChannels, err := b.u32(val(0), val(1), bitsOffset(4, 2), bitsOffset(12, 1))
+	if err != nil {
+		return h, err
+	}
+	for i := 0; i < extraChannels; i++ {
+		alpha, err := b.extraChannel()
+		if err != nil {
+			return h, err
+		}
+		h.Alpha = h.Alpha || alpha
+	}
+	if h.XYBEncoded, err = b.bool(); err != nil {
+		return h, err
+	}
+
+	// ColorEncoding, the default is sRGB without ICC profile
+	if allDefault, err := b.bool(); err != nil || allDefault {
+		return h, err
+	}
+	if h.WantICC, err = b.bool(); err != nil {
+		return h, err
+	}
+	colorSpace, err := b.enum()
+	if err != nil {
+		return h, err
+	}
+	h.Grayscale = colorSpace == colorSpaceGray
+	return h, nil
+}
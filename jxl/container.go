@@ -0,0 +1,173 @@
+// Package jxl reads JPEG XL files without decoding them: the boxes of the
+// ISOBMFF container (ISO/IEC 18181-2) and the header at the start of the
+// codestream (ISO/IEC 18181-1).
+package jxl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+var (
+	codestreamSignature = []byte{0xFF, 0x0A}
+	containerSignature  = []byte("\x00\x00\x00\x0cJXL \r\n\x87\n")
+)
+
+// headerPrefix is how much of the codestream is read for the header, which
+// only takes a few dozen bytes unless extra channels have long names.
+const headerPrefix = 4096
+
+// File is what's known about a JXL file without decoding it.
+type File struct {
+	// Container is false for a bare codestream, which has no boxes.
+	Container bool
+	// Boxes lists the box types in file order, brob boxes are listed by the
+	// type of the box they compress.
+	Boxes []string
+
+	// JPEGReconstruction is set when a jbrd box lets the original JPEG be
+	// rebuilt bit for bit.
+	JPEGReconstruction bool
+	Exif               bool
+	XMP                bool
+
+	Header Header
+}
+
+// ErrNotJXL is returned for files that don't start with a JXL signature.
+var ErrNotJXL = errors.New("not a JXL file")
+
+// ReadFile reads a JXL file.
+func ReadFile(path string) (*File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Read(file)
+}
+
+// Read reads a JXL file from its start, seeking over the content of the
+// boxes it doesn't need.
+func Read(r io.ReadSeeker) (*File, error) {
+	head := make([]byte, len(containerSignature))
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, codestreamSignature):
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		codestream, err := io.ReadAll(io.LimitReader(r, headerPrefix))
+		if err != nil {
+			return nil, err
+		}
+		f := &File{}
+		if f.Header, err = readHeader(codestream); err != nil {
+			return nil, err
+		}
+		return f, nil
+
+	case bytes.Equal(head, containerSignature):
+		return readContainer(r)
+	}
+	return nil, ErrNotJXL
+}
+
+// readContainer walks the boxes following the signature box.
+func readContainer(r io.ReadSeeker) (*File, error) {
+	f := &File{Container: true}
+	codestream := []byte{}
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("truncated box header: %w", err)
+		}
+		size := uint64(binary.BigEndian.Uint32(header[:4]))
+		boxType := string(header[4:])
+		headerSize := uint64(len(header))
+		toEnd := false
+		switch size {
+		case 0:
+			toEnd = true
+		case 1:
+			if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+				return nil, fmt.Errorf("truncated box header: %w", err)
+			}
+			headerSize += 8
+		}
+		if !toEnd && size < headerSize {
+			return nil, fmt.Errorf("invalid size of box '%s'", boxType)
+		}
+		contentSize := int64(size - headerSize)
+		if toEnd {
+			contentSize = headerPrefix
+		}
+
+		// a brob box is a brotli-compressed box, its content starts with
+		// the type of the box it holds
+		if boxType == "brob" {
+			var inner [4]byte
+			if _, err := io.ReadFull(r, inner[:]); err != nil {
+				return nil, fmt.Errorf("truncated brob box: %w", err)
+			}
+			boxType = string(inner[:])
+			contentSize -= int64(len(inner))
+		}
+		f.Boxes = append(f.Boxes, boxType)
+
+		switch boxType {
+		case "jbrd":
+			f.JPEGReconstruction = true
+		case "Exif":
+			f.Exif = true
+		case "xml ":
+			f.XMP = true
+		}
+
+		// the codestream is either whole in jxlc or split over jxlp boxes,
+		// each starting with a 4 bytes index
+		read := int64(0)
+		if (boxType == "jxlc" || boxType == "jxlp") && len(codestream) < headerPrefix {
+			skip := int64(0)
+			if boxType == "jxlp" {
+				skip = 4
+			}
+			if _, err := r.Seek(skip, io.SeekCurrent); err != nil {
+				return nil, err
+			}
+			part, err := io.ReadAll(io.LimitReader(r, min(contentSize-skip, int64(headerPrefix-len(codestream)))))
+			if err != nil {
+				return nil, err
+			}
+			codestream = append(codestream, part...)
+			read = skip + int64(len(part))
+		}
+
+		if toEnd {
+			break
+		}
+		if _, err := r.Seek(contentSize-read, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(codestream) == 0 {
+		return nil, fmt.Errorf("no codestream box")
+	}
+	var err error
+	if f.Header, err = readHeader(codestream); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"exputils/runlog"
+	"fmt"
+	"os"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	// ToggleLogButton is the divider of the log, clicking it closes the log.
+	ToggleLogButton   = Button{"toggle-log", "Log"}
+	OpenLogFileButton = Button{"open-log-file", "Open File"}
+	CloseLogButton    = Button{"close-log", "Close"}
+)
+
+// logLines is how many lines of the log are shown at once.
+const logLines = 10
+
+// logScreen shows the log of the current or last run in place of the
+// warnings, from the command block of a file.
+type logScreen struct {
+	open    bool
+	loading bool
+	path    string
+	file    string
+	lines   []string
+	// found is the line of the block of the file, -1 if it's not in the log
+	found  int
+	offset int
+	err    error
+}
+
+type LogMsg struct {
+	path  string
+	lines []string
+	err   error
+}
+
+func FetchLog(path string) tea.Cmd {
+	return func() tea.Msg {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return LogMsg{path, nil, fmt.Errorf("can't read run log: %w", err)}
+		}
+		return LogMsg{path, strings.Split(strings.TrimRight(string(data), "\n"), "\n"), nil}
+	}
+}
+
+// show opens the screen on a log, at the block of file.
+func (l *logScreen) show(path, file string) tea.Cmd {
+	l.open, l.loading, l.path, l.file = true, true, path, file
+	l.lines, l.found, l.offset, l.err = nil, -1, 0, nil
+	return FetchLog(path)
+}
+
+// update stores the lines, unless another log was opened since.
+func (l *logScreen) update(msg LogMsg) {
+	if msg.path != l.path {
+		return
+	}
+	l.lines, l.err, l.loading = msg.lines, msg.err, false
+	l.found = runlog.FindFile(l.lines, l.file)
+	l.offset = max(min(l.found, len(l.lines)-logLines), 0)
+}
+
+// handleKey scrolls the log, false if the key isn't one of the log keys.
+func (l *logScreen) handleKey(msg tea.KeyMsg) bool {
+	last := max(len(l.lines)-logLines, 0)
+	switch msg.String() {
+	case "up":
+		l.offset = max(l.offset-1, 0)
+	case "down":
+		l.offset = min(l.offset+1, last)
+	case "pgup":
+		l.offset = max(l.offset-logLines, 0)
+	case "pgdown":
+		l.offset = min(l.offset+logLines, last)
+	case "esc":
+		// back to the warnings rather than quitting
+		l.open = false
+	default:
+		return false
+	}
+	return true
+}
+
+func (l *logScreen) title() string {
+	return "Log | " + l.file
+}
+
+func (l *logScreen) view() string {
+	style := lipgloss.NewStyle().Foreground(lipgloss.Color("#949494")).PaddingLeft(2).MaxWidth(64)
+	switch {
+	case l.err != nil:
+		return style.Render(l.err.Error())
+	case l.loading:
+		return style.Render("loading...")
+	}
+
+	lines := []string{}
+	if l.found < 0 {
+		lines = append(lines, style.Foreground(lipgloss.Color("#FFD75F")).Render(fmt.Sprintf("'%s' isn't in the log", l.file)))
+	}
+	end := min(l.offset+logLines, len(l.lines))
+	for i := l.offset; i < end; i++ {
+		lineStyle := style
+		if i == l.found {
+			lineStyle = lineStyle.Foreground(lipgloss.Color("#FFF7DB")).Bold(true)
+		}
+		lines = append(lines, lineStyle.Render(l.lines[i]))
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
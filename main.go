@@ -2,11 +2,24 @@ package main
 
 import (
 	"context"
+	"exputils/config"
+	"exputils/history"
+	"exputils/notify"
+	"exputils/pathsource"
+	"exputils/plugins"
+	"exputils/procs"
+	"exputils/report"
+	"exputils/runlog"
 	"exputils/tasks"
-	wexpmonitor "exputils/wexp_monitor"
+	"exputils/undolog"
+	"exputils/utils"
+	"exputils/webhook"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
 	"time"
 
@@ -26,49 +39,99 @@ var (
 	EnablePollingButton  = Button{"enable-polling", "Polling ON"}
 	DisablePollingButton = Button{"disable-polling", "Polling OFF"}
 	CancelTaskButton     = Button{"cancel-task", "Cancel Task"}
+	TurboButton          = Button{"turbo", "Turbo"}
+	BackgroundButton     = Button{"background", "Background"}
+	OpenLogButton        = Button{"open-log", "Open Log"}
 
-	StartTaskButton    = Button{"start-task", "Demo Task"}
-	ArtefactButton     = Button{"artefact", "Artefact"}
-	DjxlButton         = Button{"djxl", "DJXL"}
-	CjxlLosslessButton = Button{"jxl", "Lossless JXL"}
-	CjxlLossyButton    = Button{"lossy-jxl", "Lossy JXL"}
-	Par2Button         = Button{"par2", "PAR2"}
+	// taskButtons has a button for every registered task, see initTaskButtons
+	taskButtons  = []*Button{}
+	taskByButton = map[*Button]tasks.Task{}
 
 	isPollingChan       = make(chan bool)
 	someTaskRunningChan = make(chan *Button)
 	warnChan            = make(chan error)
+	runLogChan          = make(chan string)
 	setProgressChan     = make(chan float64)
 
-	pollLastViewPathTicker = time.NewTicker(500 * time.Millisecond)
-	lastViewPathChan       = make(chan string)
+	// pathSource tracks the folder the tasks run on, set up in main
+	pathSource pathsource.Source
 
 	taskCtx, taskCancel = context.WithCancel(context.Background())
+
+	// webhooks is nil when the config has none, or they're invalid
+	webhooks *webhook.Dispatcher
 )
 
+func initTaskButtons() {
+	for _, task := range tasks.All() {
+		button := &Button{task.ID, task.Label}
+		taskButtons = append(taskButtons, button)
+		taskByButton[button] = task
+	}
+}
+
 type MainModel struct {
+	config config.Config
+
 	lastViewPath    string
 	isPolling       bool
 	hovered         *Button
 	someTaskRunning *Button
+	pendingConfirm  *Button
+	// pendingRerun is the past run pendingConfirm re-runs, nil when the
+	// task runs on the current folder
+	pendingRerun *history.Run
+
+	// lastReport is the report of the last finished run, nil while a task
+	// runs
+	lastReport *report.Report
+	// runLogPath is the log of the current or last run, empty before the
+	// first one
+	runLogPath string
+	// selectedFile is the file of the warning clicked, its block is shown
+	// when opening the log
+	selectedFile string
 
 	spinner          spinner.Model
 	progress         progress.Model
 	warnViewport     viewport.Model
 	accumulatedWarns []error
+
+	review     duplicatesReview
+	folderInfo folderInfo
+	history    historyScreen
+	pathEntry  pathEntry
+	browser    folderBrowser
+	places     placesScreen
+	logView    logScreen
 }
 
-func NewMainModel() MainModel {
-	return MainModel{
+// webhookCloseTimeout is how long quitting waits for pending webhooks.
+const webhookCloseTimeout = 5 * time.Second
+
+// warnLines is the height of the warnings viewport when the folder panel is
+// collapsed, it shrinks as the panel grows.
+const warnLines = 13
+
+func NewMainModel(cfg config.Config, startupWarns []error) MainModel {
+	m := MainModel{
+		config: cfg,
+
 		lastViewPath:    "",
 		isPolling:       true,
 		hovered:         &NoneButton,
 		someTaskRunning: &NoneButton,
+		pendingConfirm:  &NoneButton,
 
 		spinner:          spinner.New(func(m *spinner.Model) { m.Spinner = spinner.MiniDot }),
 		progress:         progress.New(progress.WithDefaultGradient(), progress.WithWidth(60)),
-		warnViewport:     viewport.New(60, 16),
-		accumulatedWarns: []error{},
+		warnViewport:     viewport.New(60, warnLines),
+		accumulatedWarns: startupWarns,
+
+		pathEntry: newPathEntry(),
 	}
+	m.warnViewport.SetContent(m.renderWarns())
+	return m
 }
 
 func (m *MainModel) SpawnTask(fn func(
@@ -76,13 +139,18 @@ func (m *MainModel) SpawnTask(fn func(
 	sendWarning func(error),
 	updateProgressBase func(func() float64) func(),
 )) {
-	if m.someTaskRunning == &NoneButton {
+	if m.someTaskRunning != &NoneButton {
 		return
 	}
 	m.accumulatedWarns = []error{}
+	m.lastReport = nil
+	m.selectedFile = ""
 	go func() { warnChan <- nil }()
 
 	taskCtx, taskCancel = context.WithCancel(context.Background())
+	// polling stays off after the task if it was off, like for a folder
+	// entered by hand
+	wasPolling := m.isPolling
 	go func(taskCtx context.Context) {
 		isPollingChan <- false
 		fn(
@@ -96,33 +164,204 @@ func (m *MainModel) SpawnTask(fn func(
 				}
 			},
 		)
-		isPollingChan <- true
+		isPollingChan <- wasPolling
 		someTaskRunningChan <- &NoneButton
 		setProgressChan <- 0
 	}(taskCtx)
 }
 
+// SpawnRegisteredTask runs a task from the registry on the current folder
+// with the options from the config file.
+func (m *MainModel) SpawnRegisteredTask(button *Button) {
+	task := taskByButton[button]
+	m.spawnRegisteredTask(button, m.lastViewPath, task.Options(m.config.Tasks))
+}
+
+// spawnRegisteredTask runs a task from the registry on a folder with the
+// given options, a re-run from the history uses the ones of the past run.
+func (m *MainModel) spawnRegisteredTask(button *Button, parentDir string, opts tasks.Options) {
+	if m.someTaskRunning != &NoneButton {
+		return
+	}
+	task := taskByButton[button]
+	m.review = duplicatesReview{dir: parentDir}
+
+	// runs without an undo log if there's nowhere to keep it
+	var undoLog *undolog.Log
+	undoDir, undoDirErr := undolog.Dir()
+	if undoDirErr == nil {
+		undoLog = undolog.New(undoDir, task.ID, parentDir)
+	}
+
+	go func() { someTaskRunningChan <- button }()
+	m.SpawnTask(func(ctx context.Context, sendWarning func(error), updateProgressBase func(func() float64) func()) {
+		ctx, sendWarning, closeRunLog := startRunLog(ctx, task.ID, parentDir, sendWarning)
+		defer closeRunLog()
+		sendWarning, finishRun := recordRun(task.ID, parentDir, opts, sendWarning)
+		defer finishRun(ctx)
+
+		if ok, err := task.HasMatchingFiles(parentDir); err != nil {
+			sendWarning(err)
+			return
+		} else if !ok {
+			sendWarning(fmt.Errorf("no files matching %s found", strings.Join(task.Match, ", ")))
+			return
+		}
+		ctx, err := tasks.ApplyProcessOptions(ctx, opts)
+		if err != nil {
+			sendWarning(err)
+			return
+		}
+		if !tasks.CheckDiskSpace(ctx, task, parentDir, opts, sendWarning) {
+			return
+		}
+		if undoDirErr != nil {
+			sendWarning(fmt.Errorf("changes won't be undoable: %w", undoDirErr))
+		}
+		task.Run(undolog.NewContext(ctx, undoLog), parentDir, opts, updateProgressBase, sendWarning)
+		if err := undoLog.Close(); err != nil {
+			sendWarning(fmt.Errorf("can't close undo log: %w", err))
+		}
+	})
+	m.someTaskRunning = button
+}
+
+// SpawnResolveDuplicates moves the duplicates picked in the review list away.
+func (m *MainModel) SpawnResolveDuplicates(button *Button, toTrash bool) {
+	if m.someTaskRunning != &NoneButton || !m.review.active() {
+		return
+	}
+	review := m.review
+
+	go func() { someTaskRunningChan <- button }()
+	m.SpawnTask(func(ctx context.Context, sendWarning func(error), updateProgressBase func(func() float64) func()) {
+		ctx, sendWarning, closeRunLog := startRunLog(ctx, button.ID, review.dir, sendWarning)
+		defer closeRunLog()
+		sendWarning, finishRun := recordRun(button.ID, review.dir, nil, sendWarning)
+		defer finishRun(ctx)
+
+		var undoLog *undolog.Log
+		if undoDir, err := undolog.Dir(); err != nil {
+			sendWarning(fmt.Errorf("changes won't be undoable: %w", err))
+		} else {
+			undoLog = undolog.New(undoDir, button.ID, review.dir)
+		}
+		tasks.ResolveDuplicates(undolog.NewContext(ctx, undoLog), review.dir, review.groups, toTrash, updateProgressBase, sendWarning)
+		if err := undoLog.Close(); err != nil {
+			sendWarning(fmt.Errorf("can't close undo log: %w", err))
+		}
+	})
+	m.someTaskRunning = button
+	m.review = duplicatesReview{}
+}
+
+// startRunLog creates the log of a run, the returned context carries it for
+// the tools and the returned sendWarning also writes to it. The run goes on
+// unlogged if the log can't be created.
+func startRunLog(
+	ctx context.Context,
+	taskID, folder string,
+	sendWarning func(error),
+) (context.Context, func(error), func()) {
+	dir, err := runlog.Dir()
+	if err != nil {
+		sendWarning(fmt.Errorf("run won't be logged: %w", err))
+		return ctx, sendWarning, func() {}
+	}
+	runLog, err := runlog.New(dir, taskID, folder)
+	if err != nil {
+		sendWarning(fmt.Errorf("run won't be logged: %w", err))
+		return ctx, sendWarning, func() {}
+	}
+
+	go func() { runLogChan <- runLog.Path() }()
+
+	logged := func(warn error) {
+		if err := runLog.Message(warn); err != nil {
+			sendWarning(err)
+		}
+		sendWarning(warn)
+	}
+	closeRunLog := func() {
+		if err := runLog.Close(); err != nil {
+			sendWarning(fmt.Errorf("can't close run log: %w", err))
+		}
+	}
+	return runlog.NewContext(ctx, runLog), logged, closeRunLog
+}
+
+// openLastRunLog opens the log of the current or last run, the newest one of
+// the log directory before the first run.
+func openLastRunLog(path string) error {
+	if path == "" {
+		dir, err := runlog.Dir()
+		if err != nil {
+			return err
+		}
+		if path, err = runlog.Last(dir); err != nil {
+			return err
+		}
+	}
+	if path == "" {
+		return fmt.Errorf("no run log yet")
+	}
+	return utils.OpenFile(path)
+}
+
+// openLog shows the block of the selected file in the log of the run, or
+// opens the whole log when no file is selected.
+func (m *MainModel) openLog() tea.Cmd {
+	if m.selectedFile != "" && m.runLogPath != "" {
+		m.history.open, m.browser.open, m.places.open = false, false, false
+		return m.logView.show(m.runLogPath, m.selectedFile)
+	}
+	go func(path string) {
+		if err := openLastRunLog(path); err != nil {
+			warnChan <- err
+		}
+	}(m.runLogPath)
+	return nil
+}
+
+// selectWarning selects the file of the clicked warning, or unselects it if
+// it was selected, false if no file warning was clicked.
+func (m *MainModel) selectWarning(msg tea.MouseMsg) bool {
+	for i, warn := range m.accumulatedWarns {
+		event, ok := warn.(tasks.Event)
+		if !ok || event.File == "" || !zone.Get(fmt.Sprintf("warn-%d", i)).InBounds(msg) {
+			continue
+		}
+		if m.selectedFile == event.File {
+			m.selectedFile = ""
+		} else {
+			m.selectedFile = event.File
+		}
+		m.warnViewport.SetContent(m.renderWarns())
+		return true
+	}
+	return false
+}
+
 type NewLastViewPathMsg struct{ path string }
 type SomeTaskRunningMsg struct{ running *Button }
 type SetProgressPercentMsg struct{ value float64 }
 type WarnMsg struct{ warn error }
 type IsPollingMsg struct{ polling bool }
+type RunLogMsg struct{ path string }
 
-func FetchLatestViewPath() tea.Msg     { return NewLastViewPathMsg{<-lastViewPathChan} }
+func FetchLatestViewPath() tea.Msg     { return NewLastViewPathMsg{<-pathSource.Paths()} }
 func FetchSomeTaskRunning() tea.Msg    { return SomeTaskRunningMsg{<-someTaskRunningChan} }
 func FetchSetProgressPercent() tea.Msg { return SetProgressPercentMsg{<-setProgressChan} }
 func FetchWarn() tea.Msg               { return WarnMsg{<-warnChan} }
 func FetchIsPolling() tea.Msg          { return IsPollingMsg{<-isPollingChan} }
+func FetchRunLog() tea.Msg             { return RunLogMsg{<-runLogChan} }
 
 func (m MainModel) Init() tea.Cmd {
-	go func() {
-		for range pollLastViewPathTicker.C {
-			newPath, err := wexpmonitor.GetLastViewedExplorerPath()
-			if err == nil && newPath != "" && newPath != m.lastViewPath {
-				lastViewPathChan <- newPath
-			}
-		}
-	}()
+	if err := pathSource.Start(context.Background()); err != nil {
+		go func() { warnChan <- fmt.Errorf("can't track the folder: %w", err) }()
+	} else if err := pathSource.Health().Fallback; err != nil {
+		go func() { warnChan <- err }()
+	}
 
 	return tea.Batch(
 		m.spinner.Tick,
@@ -131,6 +370,8 @@ func (m MainModel) Init() tea.Cmd {
 		FetchSetProgressPercent,
 		FetchWarn,
 		FetchIsPolling,
+		FetchReport,
+		FetchRunLog,
 	)
 }
 
@@ -156,32 +397,105 @@ func (m MainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case NewLastViewPathMsg:
 		m.lastViewPath = msg.path
-		return m, FetchLatestViewPath
+		return m, tea.Batch(FetchLatestViewPath, m.folderInfo.refresh(msg.path), VisitPlace(msg.path))
 
 	case SomeTaskRunningMsg:
+		// the task may have changed the folder
+		var refreshCmd tea.Cmd
+		if msg.running == &NoneButton && m.someTaskRunning != &NoneButton {
+			refreshCmd = m.folderInfo.refresh(m.lastViewPath)
+		}
+		var notifyCmd tea.Cmd
+		if msg.running != &NoneButton && m.someTaskRunning == &NoneButton {
+			notifyCmd = notifyStarted(m.config.Notifications)
+		}
 		m.someTaskRunning = msg.running
-		return m, FetchSomeTaskRunning
+		return m, tea.Batch(FetchSomeTaskRunning, refreshCmd, notifyCmd)
+
+	case ReportMsg:
+		m.lastReport = &msg.report
+		notifyCmd := notifyFinished(m.config.Notifications, notify.SummaryOf(msg.report))
+		return m, tea.Batch(FetchReport, m.history.refresh(), m.places.refresh(), notifyCmd)
+
+	case NotifiedMsg:
+		if msg.err != nil {
+			go func() { warnChan <- msg.err }()
+		}
+		return m, nil
+
+	case HistoryMsg:
+		m.history.update(msg)
+		return m, nil
+
+	case RunLogMsg:
+		m.runLogPath = msg.path
+		return m, FetchRunLog
+
+	case LogMsg:
+		m.logView.update(msg)
+		return m, nil
+
+	case PlacesMsg:
+		m.places.update(msg)
+		return m, nil
+
+	case PlacesChangedMsg:
+		if msg.err != nil {
+			go func() { warnChan <- msg.err }()
+		}
+		return m, m.places.refresh()
+
+	case BrowseMsg:
+		m.browser.update(msg)
+		return m, nil
+
+	case CompletionMsg:
+		m.pathEntry.complete(msg)
+		return m, nil
+
+	case PathCheckedMsg:
+		if msg.err != nil {
+			switch {
+			case m.pathEntry.editing:
+				m.pathEntry.err = msg.err
+			case m.browser.open:
+				m.browser.pickErr = msg.err
+			case m.places.open:
+				m.places.pickErr = msg.err
+			default:
+				go func() { warnChan <- msg.err }()
+			}
+			return m, nil
+		}
+		m.pathEntry.stop()
+		m.browser.open, m.places.open = false, false
+		return m, m.setFolder(msg.path)
+
+	case FolderInfoMsg:
+		m.folderInfo.update(msg)
+		m.resizeWarnings()
+		return m, nil
 
 	case WarnMsg:
+		if group, ok := msg.warn.(tasks.DuplicateGroup); ok {
+			m.review.groups = append(m.review.groups, group)
+			return m, FetchWarn
+		}
 		m.accumulatedWarns = append(m.accumulatedWarns, msg.warn)
-		m.warnViewport.SetContent(func() string {
-			var sb strings.Builder
-			for _, warn := range m.accumulatedWarns {
-				if warn == nil {
-					continue
-				}
-				sb.WriteString("- " + warn.Error() + "\n")
-			}
-			return sb.String()
-		}())
+		m.warnViewport.SetContent(m.renderWarns())
 		return m, FetchWarn
 
 	case IsPollingMsg:
+		wasPolling := m.isPolling
 		m.isPolling = msg.polling
-		if m.isPolling {
-			pollLastViewPathTicker.Reset(500 * time.Millisecond)
-		} else {
-			pollLastViewPathTicker.Stop()
+		if !m.isPolling {
+			pathSource.Stop()
+		} else if err := pathSource.Start(context.Background()); err != nil {
+			go func() { warnChan <- fmt.Errorf("can't track the folder: %w", err) }()
+		} else if current := pathSource.Current(); !wasPolling && current != "" && current != m.lastViewPath {
+			// back from a folder picked by hand
+			m.lastViewPath = current
+			return m, tea.Batch(FetchIsPolling, m.folderInfo.refresh(current))
 		}
 		return m, FetchIsPolling
 
@@ -195,25 +509,63 @@ func (m MainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.hovered = &DisablePollingButton
 			case zone.Get(CancelTaskButton.ID).InBounds(msg):
 				m.hovered = &CancelTaskButton
-			case zone.Get(StartTaskButton.ID).InBounds(msg):
-				m.hovered = &StartTaskButton
-			case zone.Get(ArtefactButton.ID).InBounds(msg):
-				m.hovered = &ArtefactButton
-			case zone.Get(DjxlButton.ID).InBounds(msg):
-				m.hovered = &DjxlButton
-			case zone.Get(CjxlLosslessButton.ID).InBounds(msg):
-				m.hovered = &CjxlLosslessButton
-			case zone.Get(CjxlLossyButton.ID).InBounds(msg):
-				m.hovered = &CjxlLossyButton
-			case zone.Get(Par2Button.ID).InBounds(msg):
-				m.hovered = &Par2Button
+			case zone.Get(TurboButton.ID).InBounds(msg):
+				m.hovered = &TurboButton
+			case zone.Get(BackgroundButton.ID).InBounds(msg):
+				m.hovered = &BackgroundButton
+			case zone.Get(OpenLogButton.ID).InBounds(msg):
+				m.hovered = &OpenLogButton
+			case zone.Get(RerunButton.ID).InBounds(msg):
+				m.hovered = &RerunButton
+			case zone.Get(OpenRunLogButton.ID).InBounds(msg):
+				m.hovered = &OpenRunLogButton
+			case zone.Get(CloseHistoryButton.ID).InBounds(msg):
+				m.hovered = &CloseHistoryButton
+			case zone.Get(OpenLogFileButton.ID).InBounds(msg):
+				m.hovered = &OpenLogFileButton
+			case zone.Get(CloseLogButton.ID).InBounds(msg):
+				m.hovered = &CloseLogButton
+			case zone.Get(UseFolderButton.ID).InBounds(msg):
+				m.hovered = &UseFolderButton
+			case zone.Get(ParentFolderButton.ID).InBounds(msg):
+				m.hovered = &ParentFolderButton
+			case zone.Get(CloseBrowserButton.ID).InBounds(msg):
+				m.hovered = &CloseBrowserButton
+			case zone.Get(PinFolderButton.ID).InBounds(msg):
+				m.hovered = &PinFolderButton
+			case zone.Get(UnpinFolderButton.ID).InBounds(msg):
+				m.hovered = &UnpinFolderButton
+			case zone.Get(ClosePlacesButton.ID).InBounds(msg):
+				m.hovered = &ClosePlacesButton
+			case zone.Get(MoveDuplicatesButton.ID).InBounds(msg):
+				m.hovered = &MoveDuplicatesButton
+			case zone.Get(TrashDuplicatesButton.ID).InBounds(msg):
+				m.hovered = &TrashDuplicatesButton
+			case zone.Get(DismissDuplicatesButton.ID).InBounds(msg):
+				m.hovered = &DismissDuplicatesButton
+			}
+			for _, button := range taskButtons {
+				if zone.Get(button.ID).InBounds(msg) {
+					m.hovered = button
+				}
 			}
 		}
 
-		if msg.Button != tea.MouseButtonLeft {
+		if msg.Button != tea.MouseButtonLeft || msg.Action != tea.MouseActionPress {
 			break
 		}
 
+		if m.browser.open {
+			if cmd, ok := m.browser.handleClick(msg); ok {
+				return m, cmd
+			}
+		}
+		if m.places.open {
+			if cmd, ok := m.places.handleClick(msg); ok {
+				return m, cmd
+			}
+		}
+
 		switch { // aka onClick
 		case zone.Get(EnablePollingButton.ID).InBounds(msg):
 			go func() { isPollingChan <- true }()
@@ -222,43 +574,141 @@ func (m MainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case zone.Get(CancelTaskButton.ID).InBounds(msg):
 			taskCancel()
 			go func() { setProgressChan <- 0 }()
-		case zone.Get(StartTaskButton.ID).InBounds(msg):
-			go func() { someTaskRunningChan <- &StartTaskButton }()
-			m.SpawnTask(func(ctx context.Context, sendWarning func(error), updateProgressBase func(func() float64) func()) {
-				tasks.ExampleTask(ctx, updateProgressBase, sendWarning)
-			})
-		case zone.Get(ArtefactButton.ID).InBounds(msg):
-			go func() { someTaskRunningChan <- &ArtefactButton }()
-			m.SpawnTask(func(ctx context.Context, sendWarning func(error), updateProgressBase func(func() float64) func()) {
-				tasks.Artefact(ctx, m.lastViewPath, 3, updateProgressBase, sendWarning)
-			})
-		case zone.Get(DjxlButton.ID).InBounds(msg):
-			go func() { someTaskRunningChan <- &DjxlButton }()
-			m.SpawnTask(func(ctx context.Context, sendWarning func(error), updateProgressBase func(func() float64) func()) {
-				tasks.Djxl(ctx, m.lastViewPath, 1, updateProgressBase, sendWarning)
-			})
-		case zone.Get(CjxlLosslessButton.ID).InBounds(msg):
-			go func() { someTaskRunningChan <- &CjxlLosslessButton }()
-			m.SpawnTask(func(ctx context.Context, sendWarning func(error), updateProgressBase func(func() float64) func()) {
-				tasks.Cjxl(ctx, m.lastViewPath, 2, false, updateProgressBase, sendWarning)
-			})
-		case zone.Get(CjxlLossyButton.ID).InBounds(msg):
-			go func() { someTaskRunningChan <- &CjxlLossyButton }()
-			m.SpawnTask(func(ctx context.Context, sendWarning func(error), updateProgressBase func(func() float64) func()) {
-				tasks.Cjxl(ctx, m.lastViewPath, 2, true, updateProgressBase, sendWarning)
-			})
-		case zone.Get(Par2Button.ID).InBounds(msg):
-			go func() { someTaskRunningChan <- &Par2Button }()
-			m.SpawnTask(func(ctx context.Context, sendWarning func(error), updateProgressBase func(func() float64) func()) {
-				tasks.Par2(ctx, m.lastViewPath, 2, updateProgressBase, sendWarning)
-			})
+		case zone.Get(TurboButton.ID).InBounds(msg):
+			setPriority(procs.Normal)
+		case zone.Get(BackgroundButton.ID).InBounds(msg):
+			setPriority(procs.Background)
+		case zone.Get(OpenLogButton.ID).InBounds(msg):
+			return m, m.openLog()
+		case m.logView.open && (zone.Get(ToggleLogButton.ID).InBounds(msg) || zone.Get(CloseLogButton.ID).InBounds(msg)):
+			m.logView.open = false
+		case m.logView.open && zone.Get(OpenLogFileButton.ID).InBounds(msg):
+			go func(path string) {
+				if err := utils.OpenFile(path); err != nil {
+					warnChan <- err
+				}
+			}(m.logView.path)
+		case !m.logView.open && !m.history.open && !m.browser.open && !m.places.open && m.selectWarning(msg):
+		case m.review.active() && zone.Get(MoveDuplicatesButton.ID).InBounds(msg):
+			m.SpawnResolveDuplicates(&MoveDuplicatesButton, false)
+		case m.review.active() && zone.Get(TrashDuplicatesButton.ID).InBounds(msg):
+			m.SpawnResolveDuplicates(&TrashDuplicatesButton, true)
+		case m.review.active() && zone.Get(DismissDuplicatesButton.ID).InBounds(msg):
+			m.review = duplicatesReview{}
+		case m.review.active() && m.review.handleClick(msg):
+		case m.lastReport != nil && zone.Get(ExportReportButton.ID).InBounds(msg):
+			go exportReport(*m.lastReport, m.config)
+		case !m.pathEntry.editing && zone.Get(EditPathButton.ID).InBounds(msg):
+			return m, m.pathEntry.start(m.lastViewPath)
+		case m.browser.open && (zone.Get(ToggleBrowserButton.ID).InBounds(msg) || zone.Get(CloseBrowserButton.ID).InBounds(msg)):
+			m.browser.open = false
+		case m.browser.open && zone.Get(UseFolderButton.ID).InBounds(msg):
+			if path := m.browser.selected(); path != "" {
+				return m, CheckFolder(path)
+			}
+		case m.browser.open && zone.Get(ParentFolderButton.ID).InBounds(msg):
+			return m, m.browser.parent()
+		case m.places.open && (zone.Get(TogglePlacesButton.ID).InBounds(msg) || zone.Get(ClosePlacesButton.ID).InBounds(msg)):
+			m.places.open = false
+		case m.places.open && zone.Get(PinFolderButton.ID).InBounds(msg):
+			if m.lastViewPath != "" {
+				return m, PinPlace(m.lastViewPath, true)
+			}
+		case m.places.open && zone.Get(UnpinFolderButton.ID).InBounds(msg):
+			if entry, ok := m.places.selected(); ok && entry.pinned {
+				return m, PinPlace(entry.path, false)
+			}
+		case zone.Get(ToggleHistoryButton.ID).InBounds(msg), m.history.open && zone.Get(CloseHistoryButton.ID).InBounds(msg):
+			return m, m.history.toggle()
+		case m.history.open && zone.Get(RerunButton.ID).InBounds(msg):
+			m.rerun()
+			return m, nil
+		case m.history.open && zone.Get(OpenRunLogButton.ID).InBounds(msg):
+			openRunLog(m.history)
+		case m.history.open && m.history.handleClick(msg):
+		case zone.Get(ToggleFolderInfoButton.ID).InBounds(msg):
+			m.folderInfo.expanded = !m.folderInfo.expanded
+			m.resizeWarnings()
+		}
+		for _, button := range taskButtons {
+			if !zone.Get(button.ID).InBounds(msg) {
+				continue
+			}
+			// tasks with a question need a second click to run
+			if taskByButton[button].Confirm != "" && (m.pendingConfirm != button || m.pendingRerun != nil) {
+				m.pendingConfirm, m.pendingRerun = button, nil
+				return m, nil
+			}
+			m.SpawnRegisteredTask(button)
 		}
+		m.pendingConfirm, m.pendingRerun = &NoneButton, nil
 
 	case tea.KeyMsg:
+		// the path and the browser take every key, letters included
+		if m.pathEntry.editing && msg.String() != "ctrl+c" {
+			return m, m.pathEntry.handleKey(msg)
+		}
+		if m.browser.open {
+			if cmd, ok := m.browser.handleKey(msg); ok {
+				return m, cmd
+			}
+		}
+		if m.places.open {
+			if cmd, ok := m.places.handleKey(msg); ok {
+				return m, cmd
+			}
+		}
+		if m.logView.open && m.logView.handleKey(msg) {
+			return m, nil
+		}
+		if m.history.open && m.history.handleKey(msg) {
+			return m, nil
+		}
+		if m.review.active() && m.someTaskRunning == &NoneButton && m.review.handleKey(msg) {
+			return m, nil
+		}
+		if choice, ok := m.pendingChoice(msg.String()); ok {
+			m.confirm(choice.Options)
+			m.pendingConfirm, m.pendingRerun = &NoneButton, nil
+			return m, nil
+		}
 		switch msg.String() {
 		case "ctrl+c", "q", "esc":
 			taskCancel()
 			return m, tea.Quit
+		case "y":
+			if m.pendingConfirm != &NoneButton {
+				m.confirm(nil)
+			}
+			m.pendingConfirm, m.pendingRerun = &NoneButton, nil
+		case "n":
+			m.pendingConfirm, m.pendingRerun = &NoneButton, nil
+		case "t":
+			if procs.CurrentPriority() == procs.Background {
+				setPriority(procs.Normal)
+			} else {
+				setPriority(procs.Background)
+			}
+		case "l":
+			return m, m.openLog()
+		case "r":
+			if m.lastReport != nil {
+				go exportReport(*m.lastReport, m.config)
+			}
+		case "h":
+			m.browser.open, m.places.open, m.logView.open = false, false, false
+			return m, m.history.toggle()
+		case "e":
+			return m, m.pathEntry.start(m.lastViewPath)
+		case "b":
+			m.history.open, m.places.open, m.logView.open = false, false, false
+			return m, m.browser.toggle(m.browseStart())
+		case "p":
+			m.history.open, m.browser.open, m.logView.open = false, false, false
+			return m, m.places.toggle()
+		case "i":
+			m.folderInfo.expanded = !m.folderInfo.expanded
+			m.resizeWarnings()
 		case "c":
 			if m.someTaskRunning == &NoneButton {
 				break
@@ -277,11 +727,149 @@ func (m MainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, viewportCmd
 }
 
+// setFolder makes path the folder of the tasks, picked by hand. Polling stops
+// so the tracked folder doesn't replace it.
+func (m *MainModel) setFolder(path string) tea.Cmd {
+	m.lastViewPath = path
+	if m.isPolling {
+		go func() { isPollingChan <- false }()
+	}
+	return tea.Batch(m.folderInfo.refresh(path), VisitPlace(path))
+}
+
+// browseStart is the folder the browser opens on, the current one or else
+// the home directory.
+func (m *MainModel) browseStart() string {
+	if m.lastViewPath != "" {
+		return m.lastViewPath
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return home
+	}
+	return string(filepath.Separator)
+}
+
+// rerun runs the task of the selected past run again, on the same folder
+// with the same options, and goes back to the warnings to follow it. Tasks
+// with a question ask it first, as when their button is clicked.
+func (m *MainModel) rerun() {
+	run, ok := m.history.selected()
+	if !ok {
+		return
+	}
+	button := buttonOfTask(run.TaskID)
+	if button == nil {
+		go func() { warnChan <- fmt.Errorf("can't re-run '%s', it's not a task", run.TaskID) }()
+		return
+	}
+	m.history.open = false
+	if taskByButton[button].Confirm != "" {
+		m.pendingConfirm, m.pendingRerun = button, &run
+		return
+	}
+	m.spawnRegisteredTask(button, run.Folder, run.Options)
+}
+
+// confirm runs the task waiting for an answer, on the current folder or the
+// one of the re-run, with the options of the choice on top.
+func (m *MainModel) confirm(choice tasks.Options) {
+	parentDir, opts := m.lastViewPath, taskByButton[m.pendingConfirm].Options(m.config.Tasks)
+	if m.pendingRerun != nil {
+		parentDir, opts = m.pendingRerun.Folder, m.pendingRerun.Options
+	}
+	if len(choice) > 0 {
+		merged := tasks.Options{}
+		for key, value := range opts {
+			merged[key] = value
+		}
+		for key, value := range choice {
+			merged[key] = value
+		}
+		opts = merged
+	}
+	m.spawnRegisteredTask(m.pendingConfirm, parentDir, opts)
+}
+
+// pendingChoice returns the choice of the task waiting for an answer that
+// the key picks.
+func (m MainModel) pendingChoice(key string) (tasks.Choice, bool) {
+	if m.pendingConfirm == &NoneButton {
+		return tasks.Choice{}, false
+	}
+	for _, choice := range taskByButton[m.pendingConfirm].Choices {
+		if choice.Key == key {
+			return choice, true
+		}
+	}
+	return tasks.Choice{}, false
+}
+
+// confirmText is the question of the task waiting for an answer, a re-run
+// tells the folder it runs on.
+func (m MainModel) confirmText() string {
+	task := taskByButton[m.pendingConfirm]
+	text := fmt.Sprintf("%s: %s", m.pendingConfirm.Label, task.Confirm)
+	if m.pendingRerun != nil {
+		text += fmt.Sprintf(" (re-run on '%s')", m.pendingRerun.Folder)
+	}
+	answers := []string{"y", "n"}
+	for _, choice := range task.Choices {
+		answers = append(answers, fmt.Sprintf("%s: %s", choice.Key, choice.Label))
+	}
+	return text + " [" + strings.Join(answers, "/") + "]"
+}
+
+// openRunLog opens the log of the selected past run.
+func openRunLog(h historyScreen) {
+	run, ok := h.selected()
+	if !ok || run.LogPath == "" {
+		return
+	}
+	go func() {
+		if err := utils.OpenFile(run.LogPath); err != nil {
+			warnChan <- err
+		}
+	}()
+}
+
+// setPriority switches the priority of the running tools and of the ones
+// started later.
+func setPriority(priority procs.Priority) {
+	for _, err := range procs.SetPriority(priority) {
+		go func() { warnChan <- err }()
+	}
+}
+
+// resizeWarnings gives the warnings viewport the lines the folder panel
+// doesn't use.
+func (m *MainModel) resizeWarnings() {
+	m.warnViewport.Height = max(warnLines-(lipgloss.Height(m.folderInfo.view())-1), 4)
+}
+
+func (m MainModel) renderWarns() string {
+	var sb strings.Builder
+	selected := lipgloss.NewStyle().Foreground(lipgloss.Color("#FFF7DB")).Bold(true)
+	for i, warn := range m.accumulatedWarns {
+		if warn == nil {
+			continue
+		}
+		line := "- " + warn.Error()
+		if event, ok := warn.(tasks.Event); ok && event.File != "" {
+			if event.File == m.selectedFile {
+				line = selected.Render(line)
+			}
+			line = zone.Mark(fmt.Sprintf("warn-%d", i), line)
+		}
+		sb.WriteString(line + "\n")
+	}
+	return sb.String()
+}
+
 func (m MainModel) View() string {
 	divider := func(title string) string {
 		var sb strings.Builder
 
-		titleLength := len(title)
+		titleLength := lipgloss.Width(title)
 		leftPad := (62 - titleLength) / 2
 		rightPad := 62 - titleLength - leftPad
 
@@ -326,53 +914,224 @@ func (m MainModel) View() string {
 		}()))
 	}
 
-	return zone.Scan(lipgloss.JoinVertical(
-		lipgloss.Top,
-		lipgloss.
-			NewStyle().
-			Foreground(lipgloss.Color("#949494")).
-			PaddingLeft(2).
-			Render(func() string {
-				if m.isPolling {
+	sections := []string{
+		func() string {
+			if m.pathEntry.editing {
+				return m.pathEntry.view()
+			}
+			return zone.Mark(EditPathButton.ID, lipgloss.
+				NewStyle().
+				Foreground(lipgloss.Color("#949494")).
+				PaddingLeft(2).
+				Render(func() string {
+					if !m.isPolling {
+						return "🛑 " + m.lastViewPath
+					}
+					if err := pathSource.Health().Err; err != nil {
+						return "⚠  " + m.lastViewPath + lipgloss.NewStyle().
+							Foreground(lipgloss.Color("#FF5F5F")).
+							Render(" (can't track: "+err.Error()+")")
+					}
 					return m.spinner.View() + "  " + m.lastViewPath
-				} else {
-					return "🛑 " + m.lastViewPath
-				}
-			}()),
+				}()))
+		}(),
 		lipgloss.NewStyle().Margin(0, 0, 0, 2).Render(lipgloss.JoinHorizontal(
 			lipgloss.Top,
 			btnStyle(&DisablePollingButton, !m.isPolling),
 			btnStyle(&EnablePollingButton, m.isPolling),
 			btnStyle(&CancelTaskButton, m.someTaskRunning == &NoneButton),
 		)),
-		divider("Tasks"),
 		lipgloss.NewStyle().Margin(0, 0, 0, 2).Render(lipgloss.JoinHorizontal(
 			lipgloss.Top,
-			btnStyle(&ArtefactButton, m.someTaskRunning != &NoneButton),
-			btnStyle(&Par2Button, m.someTaskRunning != &NoneButton),
-			btnStyle(&StartTaskButton, m.someTaskRunning != &NoneButton),
+			btnStyle(&TurboButton, procs.CurrentPriority() == procs.Normal),
+			btnStyle(&BackgroundButton, procs.CurrentPriority() == procs.Background),
+			btnStyle(&OpenLogButton, false),
 		)),
-		lipgloss.NewStyle().Margin(0, 0, 0, 2).Render(lipgloss.JoinHorizontal(
-			lipgloss.Top,
-			btnStyle(&CjxlLosslessButton, m.someTaskRunning != &NoneButton),
-			btnStyle(&CjxlLossyButton, m.someTaskRunning != &NoneButton),
-			btnStyle(&DjxlButton, m.someTaskRunning != &NoneButton),
-		)),
-		divider("Progress"),
+		zone.Mark(ToggleFolderInfoButton.ID, divider(m.folderInfo.title())),
+		m.folderInfo.view(),
+		divider("Tasks"),
+		func() string {
+			rows := []string{}
+			for i := 0; i < len(taskButtons); i += 3 {
+				row := []string{}
+				for _, button := range taskButtons[i:min(i+3, len(taskButtons))] {
+					row = append(row, btnStyle(button, m.someTaskRunning != &NoneButton))
+				}
+				rows = append(rows, lipgloss.NewStyle().Margin(0, 0, 0, 2).Render(
+					lipgloss.JoinHorizontal(lipgloss.Top, row...),
+				))
+			}
+			if m.pendingConfirm != &NoneButton {
+				rows = append(rows, lipgloss.NewStyle().
+					Foreground(lipgloss.Color("#FFD75F")).
+					PaddingLeft(2).
+					Render(m.confirmText()))
+			}
+			return lipgloss.JoinVertical(lipgloss.Top, rows...)
+		}(),
+	}
+
+	if m.review.active() {
+		sections = append(sections,
+			divider(fmt.Sprintf("Duplicates | %d groups", len(m.review.groups))),
+			m.review.view(),
+			lipgloss.NewStyle().Margin(0, 0, 0, 2).Render(lipgloss.JoinHorizontal(
+				lipgloss.Top,
+				btnStyle(&MoveDuplicatesButton, m.someTaskRunning != &NoneButton),
+				btnStyle(&TrashDuplicatesButton, m.someTaskRunning != &NoneButton),
+				btnStyle(&DismissDuplicatesButton, m.someTaskRunning != &NoneButton),
+			)),
+		)
+	}
+
+	sections = append(sections,
+		func() string {
+			if m.lastReport == nil {
+				return divider("Progress")
+			}
+			return zone.Mark(ExportReportButton.ID, divider("Progress | "+ExportReportButton.Label))
+		}(),
 		"  "+m.progress.View(),
-		divider(fmt.Sprintf("Warnings | %3.f%%", m.warnViewport.ScrollPercent()*100)),
-		m.warnViewport.View(),
-	))
+	)
+	if m.browser.open {
+		sections = append(sections,
+			zone.Mark(ToggleBrowserButton.ID, divider(m.browser.title())),
+			m.browser.view(),
+			lipgloss.NewStyle().Margin(0, 0, 0, 2).Render(lipgloss.JoinHorizontal(
+				lipgloss.Top,
+				btnStyle(&UseFolderButton, m.browser.selected() == ""),
+				btnStyle(&ParentFolderButton, filepath.Dir(m.browser.dir) == m.browser.dir),
+				btnStyle(&CloseBrowserButton, false),
+			)),
+		)
+	} else if m.places.open {
+		entry, selected := m.places.selected()
+		sections = append(sections,
+			zone.Mark(TogglePlacesButton.ID, divider(m.places.title())),
+			m.places.view(),
+			lipgloss.NewStyle().Margin(0, 0, 0, 2).Render(lipgloss.JoinHorizontal(
+				lipgloss.Top,
+				btnStyle(&PinFolderButton, m.lastViewPath == "" || m.places.isPinned(m.lastViewPath)),
+				btnStyle(&UnpinFolderButton, !selected || !entry.pinned),
+				btnStyle(&ClosePlacesButton, false),
+			)),
+		)
+	} else if m.logView.open {
+		sections = append(sections,
+			zone.Mark(ToggleLogButton.ID, divider(m.logView.title())),
+			m.logView.view(),
+			lipgloss.NewStyle().Margin(0, 0, 0, 2).Render(lipgloss.JoinHorizontal(
+				lipgloss.Top,
+				btnStyle(&OpenLogFileButton, false),
+				btnStyle(&CloseLogButton, false),
+			)),
+		)
+	} else if m.history.open {
+		run, selected := m.history.selected()
+		sections = append(sections,
+			zone.Mark(ToggleHistoryButton.ID, divider(m.history.title())),
+			m.history.view(),
+			lipgloss.NewStyle().Margin(0, 0, 0, 2).Render(lipgloss.JoinHorizontal(
+				lipgloss.Top,
+				btnStyle(&RerunButton, !selected || buttonOfTask(run.TaskID) == nil || m.someTaskRunning != &NoneButton),
+				btnStyle(&OpenRunLogButton, run.LogPath == ""),
+				btnStyle(&CloseHistoryButton, false),
+			)),
+		)
+	} else {
+		sections = append(sections,
+			zone.Mark(ToggleHistoryButton.ID, divider(fmt.Sprintf("Warnings | %3.f%% | History", m.warnViewport.ScrollPercent()*100))),
+			m.warnViewport.View(),
+		)
+	}
+
+	return zone.Scan(lipgloss.JoinVertical(lipgloss.Top, sections...))
+}
+
+// registerProfiles adds a task for every profile in the config, after the
+// built-in and plugin tasks.
+func registerProfiles(cfg config.Config) []error {
+	errs := []error{}
+	known := map[string]bool{}
+	for _, task := range tasks.All() {
+		known[task.ID] = true
+		names := []string{}
+		for name := range cfg.Profiles[task.ID] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if err := tasks.Register(task.WithProfile(name, cfg.Profiles[task.ID][name])); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	for taskID := range cfg.Profiles {
+		if !known[taskID] {
+			errs = append(errs, fmt.Errorf("profiles for unknown task '%s'", taskID))
+		}
+	}
+	return errs
 }
 
 func main() {
 	zone.NewGlobal()
 	defer zone.Close()
 
-	exec.Command("mode", "con:", "cols=64", "lines=30").Run()
+	if runtime.GOOS == "windows" {
+		exec.Command("mode", "con:", "cols=64", "lines=48").Run()
+	}
+
+	startupWarns := []error{}
+	cfg, err := config.Load()
+	if err != nil {
+		startupWarns = append(startupWarns, err)
+	}
+	if pluginsDir, err := config.Resolve(cfg.PluginsDir); err != nil {
+		startupWarns = append(startupWarns, err)
+	} else {
+		pluginTasks, err := plugins.Discover(pluginsDir)
+		if err != nil {
+			startupWarns = append(startupWarns, err)
+		}
+		for _, task := range pluginTasks {
+			if err := tasks.Register(task); err != nil {
+				startupWarns = append(startupWarns, err)
+			}
+		}
+	}
+	startupWarns = append(startupWarns, registerProfiles(cfg)...)
+	if len(cfg.Webhooks) > 0 {
+		dispatcher, err := webhook.New(cfg.Webhooks, func(err error) {
+			go func() { warnChan <- err }()
+		})
+		if err != nil {
+			startupWarns = append(startupWarns, err)
+		}
+		webhooks = dispatcher
+	}
+	if cfg.LogMaxAgeDays > 0 {
+		if logDir, err := runlog.Dir(); err != nil {
+			startupWarns = append(startupWarns, err)
+		} else if err := runlog.Cleanup(logDir, time.Duration(cfg.LogMaxAgeDays)*24*time.Hour); err != nil {
+			startupWarns = append(startupWarns, err)
+		}
+	}
+	initTaskButtons()
+	if pathSource, err = pathsource.New(cfg); err != nil {
+		startupWarns = append(startupWarns, err)
+		pathSource = pathsource.Default()
+	}
+
+	p := tea.NewProgram(NewMainModel(cfg, startupWarns), tea.WithAltScreen(), tea.WithMouseCellMotion(), tea.WithOutput(terminal))
+	_, err = p.Run()
+
+	// gives the pending webhooks a chance to go out
+	closeCtx, cancelClose := context.WithTimeout(context.Background(), webhookCloseTimeout)
+	webhooks.Close(closeCtx)
+	cancelClose()
 
-	p := tea.NewProgram(NewMainModel(), tea.WithAltScreen(), tea.WithMouseCellMotion())
-	if _, err := p.Run(); err != nil {
+	if err != nil {
 		fmt.Printf("Alas, there's been an error: %v", err)
 		os.Exit(1)
 	}
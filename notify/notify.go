@@ -0,0 +1,147 @@
+// Package notify announces the end of long task runs: terminal bell, desktop
+// notifications and title through escape sequences, and a user command
+// getting the run summary.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"exputils/config"
+	"exputils/history"
+	"exputils/report"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// commandTimeout is how long the hook command may run.
+const commandTimeout = 30 * time.Second
+
+// defaultTitle is the terminal title between runs.
+const defaultTitle = "exputils"
+
+// Summary is what the hook command gets on stdin.
+type Summary struct {
+	TaskID          string          `json:"taskId"`
+	Folder          string          `json:"folder"`
+	Started         time.Time       `json:"started"`
+	Ended           time.Time       `json:"ended"`
+	DurationSeconds float64         `json:"durationSeconds"`
+	Outcome         history.Outcome `json:"outcome"`
+	Totals          report.Totals   `json:"totals"`
+}
+
+func SummaryOf(r report.Report) Summary {
+	return Summary{
+		TaskID:          r.TaskID,
+		Folder:          r.Folder,
+		Started:         r.Started,
+		Ended:           r.Ended,
+		DurationSeconds: r.Ended.Sub(r.Started).Seconds(),
+		Outcome:         history.OutcomeOf(r),
+		Totals:          r.Totals,
+	}
+}
+
+// failed tells whether the run didn't go through.
+func (s Summary) failed() bool {
+	return s.Outcome == history.OutcomeFailed || s.Outcome == history.OutcomeCanceled
+}
+
+func (s Summary) message() string {
+	message := fmt.Sprintf("%s %s after %s", s.TaskID, s.Outcome, time.Duration(s.DurationSeconds*float64(time.Second)).Round(time.Second))
+	if s.Totals.Files > 0 {
+		message += fmt.Sprintf(", %d files", s.Totals.Files)
+	}
+	if s.Totals.Failed > 0 {
+		message += fmt.Sprintf(", %d failed", s.Totals.Failed)
+	}
+	return message
+}
+
+// Notification is how the end of a run is announced.
+type Notification struct {
+	// Sequences are the bell and desktop notification escape sequences.
+	Sequences string
+	// Title is the terminal title telling the outcome, empty to leave it.
+	Title string
+	// Command is the hook to run with RunCommand, nil for none.
+	Command []string
+}
+
+// Finished returns how to announce the end of a run, the caller writes it to
+// the terminal. Runs shorter than the threshold aren't announced.
+func Finished(cfg config.Notifications, s Summary) (Notification, error) {
+	if s.DurationSeconds < float64(cfg.MinSeconds) || (cfg.OnlyFailures && !s.failed()) {
+		return Notification{}, nil
+	}
+	message := s.message()
+
+	var n Notification
+	if cfg.Bell {
+		n.Sequences += "\a"
+	}
+	switch cfg.Desktop {
+	case "":
+	case "osc9":
+		n.Sequences += osc("9;" + sanitize(message))
+	case "osc777":
+		n.Sequences += osc("777;notify;" + sanitize(defaultTitle+": "+s.TaskID) + ";" + sanitize(message))
+	default:
+		return Notification{}, fmt.Errorf("notification 'desktop' must be 'osc9' or 'osc777', got '%s'", cfg.Desktop)
+	}
+	if cfg.Title {
+		n.Title = sanitize(defaultTitle + " | " + message)
+	}
+	if len(cfg.Command) > 0 {
+		n.Command = cfg.Command
+	}
+	return n, nil
+}
+
+// Started returns the title to put back when a run starts, a run starting
+// means the last outcome was seen. It's empty when the title is left alone.
+func Started(cfg config.Notifications) string {
+	if !cfg.Title {
+		return ""
+	}
+	return defaultTitle
+}
+
+func osc(payload string) string {
+	return "\x1b]" + payload + "\a"
+}
+
+// sanitize drops the control characters that would end the sequence early,
+// and the ";" separating the fields of OSC 777.
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == ';' {
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+// RunCommand runs the hook with the summary on stdin, it waits for the hook
+// to end.
+func RunCommand(command []string, s Summary) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdin = bytes.NewReader(data)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if len(output) > 0 {
+			return fmt.Errorf("notification command failed: %s", bytes.TrimSpace(output))
+		}
+		return fmt.Errorf("notification command failed: %w", err)
+	}
+	return nil
+}
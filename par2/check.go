@@ -0,0 +1,55 @@
+package par2
+
+import (
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+type FileState string
+
+const (
+	FileOK        FileState = "ok"
+	FileMissing   FileState = "missing"
+	FileWrongSize FileState = "wrong size"
+	FileDamaged   FileState = "damaged"
+	// FileUnknown is for files the set has no description of.
+	FileUnknown FileState = "unknown"
+)
+
+// QuickCheck compares the length and the MD5 of the first 16 KiB of a
+// protected file in dir against the set. It can miss damage past the first
+// 16 KiB, only a full verification can rule that out.
+func QuickCheck(dir string, f File) (FileState, error) {
+	if f.Name == "" {
+		return FileUnknown, nil
+	}
+
+	file, err := os.Open(filepath.Join(dir, f.Name))
+	if errors.Is(err, os.ErrNotExist) {
+		return FileMissing, nil
+	} else if err != nil {
+		return "", fmt.Errorf("can't open '%s': %w", f.Name, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", fmt.Errorf("can't stat '%s': %w", f.Name, err)
+	}
+	if uint64(info.Size()) != f.Length {
+		return FileWrongSize, nil
+	}
+
+	hash := md5.New()
+	if _, err := io.CopyN(hash, file, 16*1024); err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("can't read '%s': %w", f.Name, err)
+	}
+	if [16]byte(hash.Sum(nil)) != f.MD5_16k {
+		return FileDamaged, nil
+	}
+	return FileOK, nil
+}
@@ -0,0 +1,176 @@
+// Package par2 reads PAR2 recovery files without an external tool. It only
+// understands the packets needed to tell what a recovery set protects, it
+// can't verify or repair the protected files.
+package par2
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const headerSize = 64
+
+var magic = []byte("PAR2\x00PKT")
+
+type packetType [16]byte
+
+var (
+	typeMain          = packetType([]byte("PAR 2.0\x00Main\x00\x00\x00\x00"))
+	typeFileDesc      = packetType([]byte("PAR 2.0\x00FileDesc"))
+	typeIFSC          = packetType([]byte("PAR 2.0\x00IFSC\x00\x00\x00\x00"))
+	typeRecoverySlice = packetType([]byte("PAR 2.0\x00RecvSlic"))
+	typeCreator       = packetType([]byte("PAR 2.0\x00Creator\x00"))
+	typeUnicodeName   = packetType([]byte("PAR 2.0\x00UniFileN"))
+)
+
+// maxBodySize bounds the packets read into memory, recovery slices are
+// skipped instead and can be of any size.
+const maxBodySize = 64 * 1024 * 1024
+
+var errNotPar2 = errors.New("not a PAR2 file")
+
+type packetHeader struct {
+	length uint64
+	hash   [16]byte
+	setID  [16]byte
+	typ    packetType
+}
+
+type packet struct {
+	header packetHeader
+	body   []byte
+}
+
+// packetReader walks the packets of a PAR2 file. Damaged packets are skipped
+// by scanning for the next magic sequence, like the PAR2 spec requires.
+type packetReader struct {
+	r *bufio.Reader
+}
+
+func newPacketReader(r io.Reader) *packetReader {
+	return &packetReader{r: bufio.NewReaderSize(r, 64*1024)}
+}
+
+func (pr *packetReader) discard(n int64) error {
+	for n > 0 {
+		chunk := min(n, 1<<30)
+		if _, err := pr.r.Discard(int(chunk)); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
+
+// seekMagic advances to the next packet start, io.EOF if there's none.
+func (pr *packetReader) seekMagic() error {
+	for {
+		peek, err := pr.r.Peek(len(magic))
+		if len(peek) < len(magic) {
+			if err == nil {
+				err = io.EOF
+			}
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				err = io.EOF
+			}
+			return err
+		}
+		if bytes.Equal(peek, magic) {
+			return nil
+		}
+		if err := pr.discard(1); err != nil {
+			return err
+		}
+	}
+}
+
+// next returns the next valid packet. The body of recovery slice packets is
+// skipped and only their exponent is kept, the others are checked against
+// their MD5 hash.
+func (pr *packetReader) next() (packet, error) {
+	for {
+		if err := pr.seekMagic(); err != nil {
+			return packet{}, err
+		}
+
+		raw, err := pr.r.Peek(headerSize)
+		if err != nil {
+			return packet{}, io.EOF
+		}
+		var h packetHeader
+		h.length = binary.LittleEndian.Uint64(raw[8:16])
+		copy(h.hash[:], raw[16:32])
+		copy(h.setID[:], raw[32:48])
+		copy(h.typ[:], raw[48:64])
+
+		if h.length < headerSize || h.length%4 != 0 {
+			if err := pr.discard(1); err != nil {
+				return packet{}, err
+			}
+			continue
+		}
+		bodySize := int64(h.length - headerSize)
+
+		if h.typ == typeRecoverySlice {
+			if bodySize < 4 {
+				if err := pr.discard(1); err != nil {
+					return packet{}, err
+				}
+				continue
+			}
+			if err := pr.discard(headerSize); err != nil {
+				return packet{}, err
+			}
+			exponent := make([]byte, 4)
+			if _, err := io.ReadFull(pr.r, exponent); err != nil {
+				return packet{}, io.EOF
+			}
+			if err := pr.discard(bodySize - 4); err != nil {
+				return packet{}, io.EOF
+			}
+			return packet{header: h, body: exponent}, nil
+		}
+
+		if bodySize > maxBodySize {
+			if err := pr.discard(1); err != nil {
+				return packet{}, err
+			}
+			continue
+		}
+
+		// packets bigger than the buffer are consumed while reading, if one of
+		// them turns out to be damaged the scan resumes after it
+		var full []byte
+		consumed := h.length > uint64(pr.r.Size())
+		if consumed {
+			full = make([]byte, h.length)
+			if _, err := io.ReadFull(pr.r, full); err != nil {
+				return packet{}, io.EOF
+			}
+		} else if full, err = pr.r.Peek(int(h.length)); err != nil {
+			return packet{}, io.EOF
+		}
+
+		if md5.Sum(full[32:]) != h.hash {
+			if consumed {
+				continue
+			}
+			if err := pr.discard(1); err != nil {
+				return packet{}, err
+			}
+			continue
+		}
+
+		body := append([]byte{}, full[headerSize:]...)
+		if !consumed {
+			if err := pr.discard(int64(h.length)); err != nil {
+				return packet{}, err
+			}
+		}
+		return packet{header: h, body: body}, nil
+	}
+}
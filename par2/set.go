@@ -0,0 +1,293 @@
+package par2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+)
+
+// File is a file protected by a recovery set.
+type File struct {
+	ID     [16]byte
+	Name   string
+	Length uint64
+	MD5    [16]byte
+	// MD5_16k is the hash of the first 16 KiB of the file.
+	MD5_16k [16]byte
+	// HasChecksums tells whether the set has the per block checksums of the
+	// file, without them the file can't be verified or repaired.
+	HasChecksums bool
+}
+
+// Blocks returns the number of source blocks of the file.
+func (f File) Blocks(blockSize uint64) uint64 {
+	if blockSize == 0 {
+		return 0
+	}
+	return (f.Length + blockSize - 1) / blockSize
+}
+
+// Set is what's known about a recovery set after reading its files.
+type Set struct {
+	ID        [16]byte
+	BlockSize uint64
+	// Files are the protected files, in the order of the main packet. Files
+	// without a description packet only have their ID set.
+	Files []File
+	// RecoveryBlocks is the number of distinct recovery blocks found.
+	RecoveryBlocks int
+	Creator        string
+}
+
+// SourceBlocks returns the number of blocks of all protected files.
+func (s *Set) SourceBlocks() uint64 {
+	total := uint64(0)
+	for _, f := range s.Files {
+		total += f.Blocks(s.BlockSize)
+	}
+	return total
+}
+
+// Redundancy returns the recovery data size in percent of the protected data.
+func (s *Set) Redundancy() float64 {
+	sourceBlocks := s.SourceBlocks()
+	if sourceBlocks == 0 {
+		return 0
+	}
+	return float64(s.RecoveryBlocks) / float64(sourceBlocks) * 100
+}
+
+// Protects reports whether the set protects a file with the given name.
+func (s *Set) Protects(name string) bool {
+	for _, f := range s.Files {
+		if strings.EqualFold(f.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// setReader accumulates the packets of a set over several files.
+type setReader struct {
+	set       *Set
+	hasMain   bool
+	fileIDs   [][16]byte
+	files     map[[16]byte]*File
+	exponents map[uint32]struct{}
+}
+
+func newSetReader() *setReader {
+	return &setReader{
+		set:       &Set{},
+		files:     map[[16]byte]*File{},
+		exponents: map[uint32]struct{}{},
+	}
+}
+
+func (sr *setReader) file(id [16]byte) *File {
+	f, ok := sr.files[id]
+	if !ok {
+		f = &File{ID: id}
+		sr.files[id] = f
+	}
+	return f
+}
+
+func (sr *setReader) add(p packet) {
+	// the first main packet decides which set the files belong to, packets
+	// of other sets are ignored
+	if sr.hasMain && p.header.setID != sr.set.ID {
+		return
+	}
+
+	body := p.body
+	switch p.header.typ {
+	case typeMain:
+		if sr.hasMain || len(body) < 12 {
+			return
+		}
+		count := binary.LittleEndian.Uint32(body[8:12])
+		if uint64(len(body)) < 12+uint64(count)*16 {
+			return
+		}
+		sr.hasMain = true
+		sr.set.ID = p.header.setID
+		sr.set.BlockSize = binary.LittleEndian.Uint64(body[0:8])
+		for i := uint32(0); i < count; i++ {
+			var id [16]byte
+			copy(id[:], body[12+i*16:])
+			sr.fileIDs = append(sr.fileIDs, id)
+		}
+
+	case typeFileDesc:
+		if len(body) < 56 {
+			return
+		}
+		var id [16]byte
+		copy(id[:], body[0:16])
+		f := sr.file(id)
+		copy(f.MD5[:], body[16:32])
+		copy(f.MD5_16k[:], body[32:48])
+		f.Length = binary.LittleEndian.Uint64(body[48:56])
+		if f.Name == "" {
+			f.Name = string(bytes.TrimRight(body[56:], "\x00"))
+		}
+
+	case typeUnicodeName:
+		if len(body) < 16 || (len(body)-16)%2 != 0 {
+			return
+		}
+		var id [16]byte
+		copy(id[:], body[0:16])
+		units := make([]uint16, (len(body)-16)/2)
+		for i := range units {
+			units[i] = binary.LittleEndian.Uint16(body[16+i*2:])
+		}
+		for len(units) > 0 && units[len(units)-1] == 0 {
+			units = units[:len(units)-1]
+		}
+		sr.file(id).Name = string(utf16.Decode(units))
+
+	case typeIFSC:
+		if len(body) < 16 {
+			return
+		}
+		var id [16]byte
+		copy(id[:], body[0:16])
+		sr.file(id).HasChecksums = true
+
+	case typeRecoverySlice:
+		sr.exponents[binary.LittleEndian.Uint32(body)] = struct{}{}
+
+	case typeCreator:
+		sr.set.Creator = string(bytes.TrimRight(body, "\x00"))
+	}
+}
+
+func (sr *setReader) readFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	pr := newPacketReader(f)
+	found := false
+	for {
+		p, err := pr.next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("can't read '%s': %w", filepath.Base(path), err)
+		}
+		found = true
+		sr.add(p)
+	}
+	if !found {
+		return fmt.Errorf("'%s': %w", filepath.Base(path), errNotPar2)
+	}
+	return nil
+}
+
+func (sr *setReader) result() (*Set, error) {
+	if !sr.hasMain {
+		return nil, errors.New("recovery set has no main packet")
+	}
+	for _, id := range sr.fileIDs {
+		sr.set.Files = append(sr.set.Files, *sr.file(id))
+	}
+	sr.set.RecoveryBlocks = len(sr.exponents)
+	return sr.set, nil
+}
+
+// ReadFile reads a single .par2 file.
+func ReadFile(path string) (*Set, error) {
+	sr := newSetReader()
+	if err := sr.readFile(path); err != nil {
+		return nil, err
+	}
+	return sr.result()
+}
+
+// OpenSet reads a .par2 file together with the other files of its set in the
+// same directory, like "name.vol00+01.par2" for "name.par2".
+func OpenSet(par2File string) (*Set, error) {
+	dir := filepath.Dir(par2File)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("can't read directory: %w", err)
+	}
+
+	setName := SetName(filepath.Base(par2File))
+	sr := newSetReader()
+	errs := []error{}
+	found := false
+	for _, entry := range entries {
+		if entry.IsDir() || !IsPar2File(entry.Name()) || !strings.EqualFold(SetName(entry.Name()), setName) {
+			continue
+		}
+		if err := sr.readFile(filepath.Join(dir, entry.Name())); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		found = true
+	}
+	if !found {
+		return nil, errors.Join(append(errs, fmt.Errorf("no readable files for recovery set '%s'", setName))...)
+	}
+	return sr.result()
+}
+
+var volumeRegex = regexp.MustCompile(`(?i)\.vol\d+\+\d+\.par2$`)
+
+// IsPar2File reports whether the name has the .par2 extension.
+func IsPar2File(fileName string) bool {
+	return strings.EqualFold(filepath.Ext(fileName), ".par2")
+}
+
+// IsVolume reports whether the file is a recovery volume and not the index.
+func IsVolume(fileName string) bool {
+	return volumeRegex.MatchString(fileName)
+}
+
+// SetName returns the name of the recovery set a .par2 file belongs to,
+// "archive.7z.vol00+01.par2" and "archive.7z.par2" both give "archive.7z".
+func SetName(fileName string) string {
+	if loc := volumeRegex.FindStringIndex(fileName); loc != nil {
+		return fileName[:loc[0]]
+	}
+	return fileName[:len(fileName)-len(filepath.Ext(fileName))]
+}
+
+// FindSets returns one .par2 file per recovery set among the file names,
+// the index file if it's there, else the first recovery volume.
+func FindSets(fileNames []string) []string {
+	sets := map[string]string{}
+	order := []string{}
+	for _, fileName := range fileNames {
+		if !IsPar2File(fileName) {
+			continue
+		}
+		setName := strings.ToLower(SetName(fileName))
+		current, ok := sets[setName]
+		if !ok {
+			order = append(order, setName)
+		}
+		if !ok || (IsVolume(current) && !IsVolume(fileName)) {
+			sets[setName] = fileName
+		}
+	}
+
+	par2Files := []string{}
+	for _, setName := range order {
+		par2Files = append(par2Files, sets[setName])
+	}
+	return par2Files
+}
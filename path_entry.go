@@ -0,0 +1,253 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/bubbles/cursor"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// EditPathButton is the path line, clicking it edits the path.
+var EditPathButton = Button{"edit-path", "Edit Path"}
+
+// pathEntry is the path line while it's edited, tab completes the folder
+// names.
+type pathEntry struct {
+	input   textinput.Model
+	editing bool
+	err     error
+	// matches are the folders of the last completion, another tab cycles
+	// through them as long as the value is the completed one
+	matches   []string
+	match     int
+	completed string
+}
+
+// PathCheckedMsg tells whether a path entered or browsed to can be the
+// folder of the tasks.
+type PathCheckedMsg struct {
+	path string
+	err  error
+}
+
+type CompletionMsg struct {
+	value   string
+	matches []string
+	err     error
+}
+
+func newPathEntry() pathEntry {
+	input := textinput.New()
+	input.Prompt = "> "
+	input.Placeholder = "folder path"
+	input.Width = 58
+	input.Cursor.SetMode(cursor.CursorStatic)
+	return pathEntry{input: input}
+}
+
+// start edits the path, starting from the current one.
+func (p *pathEntry) start(path string) tea.Cmd {
+	p.editing, p.err, p.matches = true, nil, nil
+	p.input.SetValue(path)
+	p.input.CursorEnd()
+	return p.input.Focus()
+}
+
+func (p *pathEntry) stop() {
+	p.editing, p.err, p.matches = false, nil, nil
+	p.input.Blur()
+}
+
+// handleKey edits the path, enter checks it, esc gives up.
+func (p *pathEntry) handleKey(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "esc":
+		p.stop()
+		return nil
+	case "enter":
+		return CheckFolder(p.input.Value())
+	case "tab":
+		if len(p.matches) > 1 && p.input.Value() == p.completed {
+			p.match = (p.match + 1) % len(p.matches)
+			p.setCompleted(p.matches[p.match] + string(filepath.Separator))
+			return nil
+		}
+		return CompleteFolder(p.input.Value())
+	}
+	p.err, p.matches = nil, nil
+	var cmd tea.Cmd
+	p.input, cmd = p.input.Update(msg)
+	return cmd
+}
+
+func (p *pathEntry) setCompleted(value string) {
+	p.input.SetValue(value)
+	p.input.CursorEnd()
+	p.completed = value
+}
+
+// complete fills in the folder of the only match, or what the matches have
+// in common.
+func (p *pathEntry) complete(msg CompletionMsg) {
+	if msg.value != p.input.Value() {
+		return
+	}
+	p.err, p.matches, p.match = msg.err, nil, -1
+	switch {
+	case msg.err != nil:
+	case len(msg.matches) == 0:
+		p.err = fmt.Errorf("no folder starting with '%s'", filepath.Base(msg.value))
+	case len(msg.matches) == 1:
+		p.setCompleted(msg.matches[0] + string(filepath.Separator))
+	default:
+		p.matches = msg.matches
+		// the typed case may differ from the one of the folders
+		if prefix := commonPrefix(msg.matches); len(prefix) >= len(msg.value) {
+			p.setCompleted(prefix)
+		} else {
+			p.completed = msg.value
+		}
+	}
+}
+
+func (p *pathEntry) view() string {
+	lines := []string{lipgloss.NewStyle().PaddingLeft(2).Render(p.input.View())}
+	hint := lipgloss.NewStyle().Foreground(lipgloss.Color("#949494")).PaddingLeft(4).MaxWidth(64)
+	switch {
+	case p.err != nil:
+		lines = append(lines, hint.Foreground(lipgloss.Color("#FF5F5F")).Render(p.err.Error()))
+	case len(p.matches) > 1:
+		names := []string{}
+		for i, match := range p.matches {
+			name := filepath.Base(match)
+			if i == p.match {
+				name = lipgloss.NewStyle().Foreground(lipgloss.Color("#FFF7DB")).Render(name)
+			}
+			names = append(names, name)
+		}
+		lines = append(lines, hint.Render(strings.Join(names, "  ")))
+	default:
+		lines = append(lines, hint.Render("enter to use, tab to complete, esc to cancel"))
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
+
+// CheckFolder makes sure a path is a folder that can be read, ~ is the home
+// directory.
+func CheckFolder(value string) tea.Cmd {
+	return func() tea.Msg {
+		path, err := expandHome(strings.TrimSpace(value))
+		if err != nil {
+			return PathCheckedMsg{value, err}
+		}
+		if path == "" {
+			return PathCheckedMsg{path, errors.New("no path entered")}
+		}
+		path = filepath.Clean(path)
+		return PathCheckedMsg{path, checkFolder(path)}
+	}
+}
+
+func checkFolder(path string) error {
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("'%s' isn't an absolute path", path)
+	}
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("'%s' doesn't exist", path)
+	} else if err != nil {
+		return fmt.Errorf("can't open '%s': %w", path, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("'%s' isn't a folder", path)
+	}
+
+	dir, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("can't open '%s': %w", path, err)
+	}
+	defer dir.Close()
+	if _, err := dir.Readdirnames(1); err != nil && err != io.EOF {
+		return fmt.Errorf("can't read '%s': %w", path, err)
+	}
+	return nil
+}
+
+// CompleteFolder lists the folders whose path starts with the value, the case
+// of the last name doesn't matter.
+func CompleteFolder(value string) tea.Cmd {
+	return func() tea.Msg {
+		path, err := expandHome(value)
+		if err != nil {
+			return CompletionMsg{value, nil, err}
+		}
+		dir, prefix := filepath.Split(path)
+		if !filepath.IsAbs(dir) {
+			return CompletionMsg{value, nil, fmt.Errorf("'%s' isn't an absolute path", value)}
+		}
+		names, err := listFolders(dir)
+		if err != nil {
+			return CompletionMsg{value, nil, err}
+		}
+
+		matches := []string{}
+		for _, name := range names {
+			if strings.HasPrefix(strings.ToLower(name), strings.ToLower(prefix)) {
+				matches = append(matches, filepath.Join(dir, name))
+			}
+		}
+		return CompletionMsg{value, matches, nil}
+	}
+}
+
+// listFolders returns the names of the folders in dir, sorted.
+func listFolders(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("can't read '%s': %w", dir, err)
+	}
+	names := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		} else if entry.Type()&os.ModeSymlink != 0 {
+			if info, err := os.Stat(filepath.Join(dir, entry.Name())); err == nil && info.IsDir() {
+				names = append(names, entry.Name())
+			}
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return strings.ToLower(names[i]) < strings.ToLower(names[j]) })
+	return names, nil
+}
+
+// expandHome replaces a leading ~ with the home directory.
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") && !strings.HasPrefix(path, `~\`) {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("can't find home directory: %w", err)
+	}
+	return filepath.Join(home, path[1:]), nil
+}
+
+func commonPrefix(values []string) string {
+	prefix := values[0]
+	for _, value := range values[1:] {
+		for !strings.HasPrefix(value, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+	return prefix
+}
@@ -0,0 +1,329 @@
+//go:build linux
+
+package pathsource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	fileManagerInterface = "org.freedesktop.FileManager1"
+	fileManagerPath      = dbus.ObjectPath("/org/freedesktop/FileManager1")
+)
+
+// fileManagerNames are the bus names of the file managers, a file manager
+// owns the first one when it's the default and its own one otherwise.
+var fileManagerNames = []string{
+	fileManagerInterface,
+	"org.gnome.Nautilus",
+	"org.Nemo",
+}
+
+// fileManagerPrefixes are for the file managers with a name per process.
+var fileManagerPrefixes = []string{"org.kde.dolphin-"}
+
+// DBus follows the folder open in the file managers of the session bus,
+// through the locations they publish on org.freedesktop.FileManager1. The
+// folder of the focused window is taken when the desktop tells which window
+// has the focus, otherwise the one of the window that last changed folder.
+type DBus struct {
+	// address is the bus to connect to, empty for the session bus
+	address string
+	focused func() (string, error)
+	// interval is how often the focused window is checked, the locations
+	// come with signals
+	interval time.Duration
+	paths    chan string
+
+	mutex   sync.Mutex
+	cancel  context.CancelFunc
+	runCtx  context.Context
+	current string
+	health  Health
+}
+
+// NewDBus returns a source on the bus at address, the session bus when it's
+// empty. focused returns the object path of the focused file manager window,
+// empty when it's unknown, nil never knows it.
+func NewDBus(address string, focused func() (string, error)) *DBus {
+	return &DBus{address: address, focused: focused, interval: time.Second, paths: make(chan string)}
+}
+
+func newDBus() (Source, error) { return NewDBus("", FocusedX11Window), nil }
+
+func (d *DBus) Start(ctx context.Context) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.cancel != nil {
+		return nil
+	}
+
+	var conn *dbus.Conn
+	var err error
+	if d.address == "" {
+		conn, err = dbus.ConnectSessionBus()
+	} else {
+		conn, err = dbus.Connect(d.address)
+	}
+	if err != nil {
+		d.health.Err = fmt.Errorf("can't connect to the session bus: %w", err)
+		return d.health.Err
+	}
+	err = conn.AddMatchSignal(
+		dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
+		dbus.WithMatchMember("PropertiesChanged"),
+		dbus.WithMatchArg(0, fileManagerInterface),
+	)
+	if err != nil {
+		conn.Close()
+		d.health.Err = fmt.Errorf("can't watch the file managers: %w", err)
+		return d.health.Err
+	}
+	signals := make(chan *dbus.Signal, 16)
+	conn.Signal(signals)
+
+	ctx, d.cancel = context.WithCancel(ctx)
+	d.runCtx = ctx
+	d.health.Running, d.health.Err = true, nil
+	go d.run(ctx, conn, signals)
+	return nil
+}
+
+func (d *DBus) run(ctx context.Context, conn *dbus.Conn, signals <-chan *dbus.Signal) {
+	defer conn.Close()
+	defer d.ended(ctx)
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	tracker := windowTracker{}
+	for first := true; ; first = false {
+		if !first {
+			select {
+			case <-ctx.Done():
+				return
+			case <-signals:
+			case <-ticker.C:
+			}
+		}
+
+		path, err := d.lookup(conn, &tracker)
+		d.mutex.Lock()
+		d.health.Err, d.health.Checked = err, time.Now()
+		changed := path != "" && path != d.current
+		if changed {
+			d.current = path
+		}
+		d.mutex.Unlock()
+
+		if changed {
+			select {
+			case d.paths <- path:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// ended marks the source as stopped when its context is done, so it can be
+// started again, unless it was restarted since.
+func (d *DBus) ended(ctx context.Context) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.runCtx == ctx {
+		d.cancel, d.runCtx = nil, nil
+		d.health.Running = false
+	}
+}
+
+// lookup returns the folder of the window the tracker picks among the
+// windows of every file manager. When the focused window can't be told, the
+// folder is picked without it and the error is returned along with it.
+func (d *DBus) lookup(conn *dbus.Conn, tracker *windowTracker) (string, error) {
+	windows, err := fileManagerWindows(conn)
+	if err != nil {
+		return "", err
+	}
+	focused := ""
+	if d.focused != nil {
+		if focused, err = d.focused(); err != nil {
+			focused = ""
+		}
+	}
+	return tracker.pick(windows, focused), err
+}
+
+// fileManagerWindows returns the folders open in each window of the file
+// managers on the bus, by window object path. The file managers telling only
+// their folders get a window named after them.
+func fileManagerWindows(conn *dbus.Conn) (map[string][]string, error) {
+	var names []string
+	if err := conn.BusObject().Call("org.freedesktop.DBus.ListNames", 0).Store(&names); err != nil {
+		return nil, fmt.Errorf("can't list the bus names: %w", err)
+	}
+
+	// a file manager can own several of the names
+	owners := []string{}
+	for _, name := range names {
+		if !slices.Contains(fileManagerNames, name) && !hasAnyPrefix(name, fileManagerPrefixes) {
+			continue
+		}
+		var owner string
+		if err := conn.BusObject().Call("org.freedesktop.DBus.GetNameOwner", 0, name).Store(&owner); err != nil {
+			continue
+		}
+		if !slices.Contains(owners, owner) {
+			owners = append(owners, owner)
+		}
+	}
+
+	windows := map[string][]string{}
+	for _, owner := range owners {
+		object := conn.Object(owner, fileManagerPath)
+		var byWindow map[string][]string
+		if v, err := object.GetProperty(fileManagerInterface + ".OpenWindowsWithLocations"); err == nil && v.Store(&byWindow) == nil {
+			for window, locations := range byWindow {
+				windows[window] = folderPaths(locations)
+			}
+			continue
+		}
+		var locations []string
+		if v, err := object.GetProperty(fileManagerInterface + ".OpenLocations"); err == nil && v.Store(&locations) == nil {
+			windows[owner] = folderPaths(locations)
+		}
+	}
+	return windows, nil
+}
+
+// folderPaths returns the local paths of the location URIs, the other ones
+// like trash:/// are left out.
+func folderPaths(locations []string) []string {
+	paths := []string{}
+	for _, location := range locations {
+		u, err := url.Parse(location)
+		if err == nil && u.Scheme == "file" && u.Path != "" {
+			paths = append(paths, u.Path)
+		}
+	}
+	return paths
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// windowTracker remembers the windows between lookups, to tell which one
+// changed folder last.
+type windowTracker struct {
+	windows map[string][]string
+	last    string
+}
+
+// pick returns the folder of the focused window if it's a file manager one,
+// or of the window that changed last. The first folder of a window is its
+// active tab.
+func (t *windowTracker) pick(windows map[string][]string, focused string) string {
+	previous := t.windows
+	t.windows = windows
+
+	if len(windows[focused]) > 0 {
+		t.last = focused
+		return windows[focused][0]
+	}
+
+	keys := make([]string, 0, len(windows))
+	for window, paths := range windows {
+		if len(paths) > 0 {
+			keys = append(keys, window)
+		}
+	}
+	sort.Strings(keys)
+	for _, window := range keys {
+		if window != t.last && !slices.Equal(windows[window], previous[window]) {
+			t.last = window
+			break
+		}
+	}
+	if len(windows[t.last]) == 0 {
+		if len(keys) == 0 {
+			t.last = ""
+			return ""
+		}
+		t.last = keys[0]
+	}
+	return windows[t.last][0]
+}
+
+func (d *DBus) Stop() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.cancel != nil {
+		d.cancel()
+		d.cancel = nil
+	}
+	d.health.Running = false
+}
+
+func (d *DBus) Paths() <-chan string { return d.paths }
+
+func (d *DBus) Current() string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.current
+}
+
+func (d *DBus) Health() Health {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.health
+}
+
+// FocusedX11Window returns the object path GTK gives the focused window, it's
+// empty outside X11, without xprop, or when the window isn't a GTK one.
+func FocusedX11Window() (string, error) {
+	if os.Getenv("DISPLAY") == "" {
+		return "", nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "xprop", "-root", "_NET_ACTIVE_WINDOW").Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("can't get the focused window: %w", err)
+	}
+	// _NET_ACTIVE_WINDOW(WINDOW): window id # 0x3a00007
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 || !strings.HasPrefix(fields[len(fields)-1], "0x") {
+		return "", nil
+	}
+
+	out, err = exec.CommandContext(ctx, "xprop", "-id", fields[len(fields)-1], "_GTK_WINDOW_OBJECT_PATH").Output()
+	if err != nil {
+		return "", nil
+	}
+	// _GTK_WINDOW_OBJECT_PATH(UTF8_STRING) = "/org/gnome/Nautilus/window/1"
+	_, value, found := strings.Cut(string(out), "=")
+	if !found {
+		return "", nil
+	}
+	return strings.Trim(strings.TrimSpace(value), `"`), nil
+}
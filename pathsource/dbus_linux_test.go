@@ -0,0 +1,205 @@
+package pathsource
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+func TestWindowTrackerPick(t *testing.T) {
+	tracker := windowTracker{}
+	windows := map[string][]string{"/w/1": {"/a"}, "/w/2": {"/b", "/b2"}}
+	if path := tracker.pick(windows, "/w/2"); path != "/b" {
+		t.Errorf("focused window: got %q, want /b", path)
+	}
+	// the focused window isn't a file manager one, the last one stays
+	if path := tracker.pick(windows, "/other"); path != "/b" {
+		t.Errorf("unknown focused window: got %q, want /b", path)
+	}
+
+	windows = map[string][]string{"/w/1": {"/c"}, "/w/2": {"/b", "/b2"}}
+	if path := tracker.pick(windows, ""); path != "/c" {
+		t.Errorf("window that changed: got %q, want /c", path)
+	}
+	if path := tracker.pick(windows, ""); path != "/c" {
+		t.Errorf("nothing changed: got %q, want /c", path)
+	}
+
+	// the last window closed, another one is taken
+	if path := tracker.pick(map[string][]string{"/w/2": {"/b"}}, ""); path != "/b" {
+		t.Errorf("closed window: got %q, want /b", path)
+	}
+	if path := tracker.pick(map[string][]string{}, ""); path != "" {
+		t.Errorf("no window: got %q, want none", path)
+	}
+}
+
+// fileManager is a stand-in for a file manager publishing its windows on
+// org.freedesktop.FileManager1.
+type fileManager struct {
+	conn *dbus.Conn
+
+	mutex   sync.Mutex
+	windows map[string][]string
+}
+
+// properties returns a copy of the windows, the replies are encoded after
+// the mutex is released.
+func (f *fileManager) properties() map[string]dbus.Variant {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	windows := map[string][]string{}
+	for window, locations := range f.windows {
+		windows[window] = locations
+	}
+	return map[string]dbus.Variant{"OpenWindowsWithLocations": dbus.MakeVariant(windows)}
+}
+
+// Get and GetAll implement org.freedesktop.DBus.Properties.
+func (f *fileManager) Get(iface, property string) (dbus.Variant, *dbus.Error) {
+	value, ok := f.properties()[property]
+	if iface != fileManagerInterface || !ok {
+		return dbus.Variant{}, dbus.MakeFailedError(dbus.ErrMsgUnknownInterface)
+	}
+	return value, nil
+}
+
+func (f *fileManager) GetAll(iface string) (map[string]dbus.Variant, *dbus.Error) {
+	return f.properties(), nil
+}
+
+// open sets the locations of a window and tells the bus.
+func (f *fileManager) open(window string, locations ...string) error {
+	f.mutex.Lock()
+	f.windows[window] = locations
+	f.mutex.Unlock()
+	return f.conn.Emit(fileManagerPath, "org.freedesktop.DBus.Properties.PropertiesChanged",
+		fileManagerInterface, f.properties(), []string{})
+}
+
+// startBus starts a private session bus, the test is skipped without
+// dbus-daemon.
+func startBus(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("dbus-daemon not found")
+	}
+	cmd := exec.Command("dbus-daemon", "--session", "--nofork", "--print-address")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Skipf("can't start dbus-daemon: %v", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("no bus address: %v", err)
+	}
+	return strings.TrimSpace(address)
+}
+
+func startFileManager(t *testing.T, address string, windows map[string][]string) *fileManager {
+	t.Helper()
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	f := &fileManager{conn: conn, windows: windows}
+	if err := conn.Export(f, fileManagerPath, "org.freedesktop.DBus.Properties"); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := conn.RequestName(fileManagerInterface, dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("can't own %s: %v", fileManagerInterface, err)
+	}
+	return f
+}
+
+func TestDBusFollowsFileManager(t *testing.T) {
+	address := startBus(t)
+	f := startFileManager(t, address, map[string][]string{
+		"/w/1": {"file:///a"},
+		"/w/2": {"file:///b", "trash:///"},
+	})
+
+	var focused atomic.Value
+	focused.Store("/w/2")
+	d := NewDBus(address, func() (string, error) { return focused.Load().(string), nil })
+	d.interval = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := d.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Stop()
+
+	// the focused window wins
+	if path := receive(t, d); path != "/b" {
+		t.Errorf("focused window: got %q, want /b", path)
+	}
+	if d.Current() != "/b" {
+		t.Errorf("Current() = %q, want /b", d.Current())
+	}
+
+	// without a focused window, the one that changed folder
+	focused.Store("")
+	if err := f.open("/w/1", "file:///c"); err != nil {
+		t.Fatal(err)
+	}
+	if path := receive(t, d); path != "/c" {
+		t.Errorf("changed window: got %q, want /c", path)
+	}
+
+	if health := d.Health(); !health.Running || health.Err != nil {
+		t.Errorf("health %+v, want running without error", health)
+	}
+	cancel()
+	waitStopped(t, d)
+}
+
+func TestDBusFocusError(t *testing.T) {
+	address := startBus(t)
+	startFileManager(t, address, map[string][]string{"/w/1": {"file:///a"}})
+
+	focusErr := errors.New("xprop failed")
+	d := NewDBus(address, func() (string, error) { return "", focusErr })
+	d.interval = 10 * time.Millisecond
+	if err := d.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Stop()
+
+	// the window is still picked, the error only shows in the health
+	if path := receive(t, d); path != "/a" {
+		t.Errorf("got %q, want /a", path)
+	}
+	if health := d.Health(); !health.Running || !errors.Is(health.Err, focusErr) {
+		t.Errorf("health %+v, want running with the focus error", health)
+	}
+}
+
+func TestDBusWithoutBus(t *testing.T) {
+	d := NewDBus("unix:path=/nonexistent/bus", nil)
+	if err := d.Start(context.Background()); err == nil {
+		d.Stop()
+		t.Fatal("started without a bus")
+	}
+	if health := d.Health(); health.Running || health.Err == nil {
+		t.Errorf("health %+v, want stopped with an error", health)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package pathsource
+
+import "errors"
+
+func newDBus() (Source, error) {
+	return nil, errors.New("folder tracking by D-Bus needs Linux")
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package pathsource
+
+import (
+	"os"
+	"time"
+)
+
+// Default reports the working directory, there's no file manager to follow
+// by default outside Windows.
+func Default() Source {
+	return NewPolling(os.Getwd, 2*time.Second)
+}
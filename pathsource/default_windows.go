@@ -0,0 +1,13 @@
+//go:build windows
+
+package pathsource
+
+import (
+	wexpmonitor "exputils/wexp_monitor"
+	"time"
+)
+
+// Default polls the path of the foreground File Explorer window.
+func Default() Source {
+	return NewPolling(wexpmonitor.GetLastViewedExplorerPath, 500*time.Millisecond)
+}
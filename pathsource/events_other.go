@@ -0,0 +1,9 @@
+//go:build !windows
+
+package pathsource
+
+import "errors"
+
+func newEvents() (Source, error) {
+	return nil, errors.New("folder tracking by events needs Windows")
+}
@@ -0,0 +1,135 @@
+//go:build windows
+
+package pathsource
+
+import (
+	"context"
+	wexpmonitor "exputils/wexp_monitor"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Events follows the Explorer windows through WinEvents, and falls back on
+// polling when the event hook can't be set.
+type Events struct {
+	paths chan string
+	// force asks the monitor for the path right away
+	force chan struct{}
+
+	mutex    sync.Mutex
+	cancel   context.CancelFunc
+	runCtx   context.Context
+	current  string
+	health   Health
+	fallback *Polling
+}
+
+func NewEvents() *Events {
+	return &Events{paths: make(chan string), force: make(chan struct{}, 1)}
+}
+
+func newEvents() (Source, error) { return NewEvents(), nil }
+
+func (e *Events) Start(ctx context.Context) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.fallback != nil {
+		return e.fallback.Start(ctx)
+	}
+	if e.cancel != nil {
+		return nil
+	}
+
+	monitorCtx, cancel := context.WithCancel(ctx)
+	found := make(chan string)
+	err := wexpmonitor.MonitorWindowsExplorer(monitorCtx, found, e.force, func(err error) {
+		e.mutex.Lock()
+		defer e.mutex.Unlock()
+		e.health.Err, e.health.Checked = err, time.Now()
+	})
+	if err != nil {
+		cancel()
+		e.fallback = newPolling(wexpmonitor.GetLastViewedExplorerPath, 500*time.Millisecond, e.paths)
+		e.health.Fallback = fmt.Errorf("%w, polling instead", err)
+		return e.fallback.Start(ctx)
+	}
+
+	e.cancel, e.runCtx = cancel, monitorCtx
+	e.health.Running = true
+	go e.forward(monitorCtx, found)
+	// the first path comes without waiting for Explorer to change
+	select {
+	case e.force <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (e *Events) forward(ctx context.Context, found <-chan string) {
+	defer e.ended(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case path := <-found:
+			e.mutex.Lock()
+			e.current = path
+			e.health.Err, e.health.Checked = nil, time.Now()
+			e.mutex.Unlock()
+
+			select {
+			case e.paths <- path:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// ended marks the source as stopped when its context is done, so it can be
+// started again, unless it was restarted since.
+func (e *Events) ended(ctx context.Context) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.runCtx == ctx {
+		e.cancel, e.runCtx = nil, nil
+		e.health.Running = false
+	}
+}
+
+func (e *Events) Stop() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.fallback != nil {
+		e.fallback.Stop()
+		return
+	}
+	if e.cancel != nil {
+		e.cancel()
+		e.cancel = nil
+	}
+	e.health.Running = false
+}
+
+func (e *Events) Paths() <-chan string { return e.paths }
+
+func (e *Events) Current() string {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.fallback != nil {
+		return e.fallback.Current()
+	}
+	return e.current
+}
+
+func (e *Events) Health() Health {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.fallback != nil {
+		health := e.fallback.Health()
+		health.Fallback = e.health.Fallback
+		return health
+	}
+	return e.health
+}
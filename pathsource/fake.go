@@ -0,0 +1,90 @@
+package pathsource
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Fake is a source driven by hand, for tests and for running the TUI on a
+// fixed folder.
+type Fake struct {
+	paths chan string
+
+	mutex   sync.Mutex
+	cancel  context.CancelFunc
+	runCtx  context.Context
+	running bool
+	current string
+	err     error
+}
+
+func NewFake() *Fake {
+	return &Fake{paths: make(chan string, 16)}
+}
+
+// Set reports a new folder, it's dropped while the source is stopped like
+// the folders a real source would miss.
+func (f *Fake) Set(path string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if !f.running || path == f.current {
+		return
+	}
+	f.current = path
+	select {
+	case f.paths <- path:
+	default:
+	}
+}
+
+// SetErr sets the error reported by Health.
+func (f *Fake) SetErr(err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.err = err
+}
+
+// Start takes folders until Stop is called or ctx is done.
+func (f *Fake) Start(ctx context.Context) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.running {
+		return nil
+	}
+	ctx, f.cancel = context.WithCancel(ctx)
+	f.runCtx, f.running = ctx, true
+	go func() {
+		<-ctx.Done()
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		// unless it was restarted since
+		if f.runCtx == ctx {
+			f.cancel, f.runCtx, f.running = nil, nil, false
+		}
+	}()
+	return nil
+}
+
+func (f *Fake) Stop() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.cancel != nil {
+		f.cancel()
+	}
+	f.cancel, f.runCtx, f.running = nil, nil, false
+}
+
+func (f *Fake) Paths() <-chan string { return f.paths }
+
+func (f *Fake) Current() string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.current
+}
+
+func (f *Fake) Health() Health {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return Health{Running: f.running, Err: f.err, Checked: time.Now()}
+}
@@ -0,0 +1,64 @@
+// Package pathsource tracks the folder the user is looking at, the folder the
+// tasks run on. Each platform has its own way to find it, behind Source.
+package pathsource
+
+import (
+	"context"
+	"exputils/config"
+	"fmt"
+	"time"
+)
+
+// Source reports the folder the user is looking at.
+type Source interface {
+	// Start tracks the folder until Stop is called or ctx is done, starting
+	// a running source does nothing.
+	Start(ctx context.Context) error
+	// Stop pauses the tracking, it can be started again.
+	Stop()
+	// Paths gets every new folder, the channel is the same across restarts.
+	Paths() <-chan string
+	// Current returns the last folder found, empty before the first one.
+	Current() string
+	Health() Health
+}
+
+// Health is how a source is doing.
+type Health struct {
+	// Running is false before Start and after Stop.
+	Running bool
+	// Err is the error of the last check, nil when it worked.
+	Err error
+	// Checked is when the folder was last looked for.
+	Checked time.Time
+	// Fallback is why the source is polling instead of its own way, nil if
+	// it isn't.
+	Fallback error
+}
+
+const (
+	// ModePolling asks for the folder at a fixed interval.
+	ModePolling = "polling"
+	// ModeEvents follows the Explorer windows as they change, Windows only.
+	ModeEvents = "events"
+	// ModeDBus follows the file managers of the session bus, Linux only.
+	ModeDBus = "dbus"
+	// ModeShell follows the working directory of a shell.
+	ModeShell = "shell"
+)
+
+// New returns the source of the tracking mode of the config, the default one
+// when it's empty.
+func New(cfg config.Config) (Source, error) {
+	switch cfg.PathSource {
+	case "", ModePolling:
+		return Default(), nil
+	case ModeEvents:
+		return newEvents()
+	case ModeDBus:
+		return newDBus()
+	case ModeShell:
+		return NewShell(cfg.Shell)
+	}
+	return nil, fmt.Errorf("unknown folder tracking mode '%s'", cfg.PathSource)
+}
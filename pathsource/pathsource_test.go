@@ -0,0 +1,110 @@
+package pathsource
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// receive returns the next folder of a source, failing after a second.
+func receive(t *testing.T, s Source) string {
+	t.Helper()
+	select {
+	case path := <-s.Paths():
+		return path
+	case <-time.After(time.Second):
+		t.Fatal("no folder received")
+		return ""
+	}
+}
+
+// waitStopped waits for a source to tell it isn't running anymore.
+func waitStopped(t *testing.T, s Source) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for s.Health().Running {
+		if time.Now().After(deadline) {
+			t.Fatal("source still running")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFakeDropsFoldersWhileStopped(t *testing.T) {
+	f := NewFake()
+	f.Set("/before")
+	if f.Current() != "" {
+		t.Errorf("Current() = %q before Start, want none", f.Current())
+	}
+
+	if err := f.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	f.Set("/a")
+	if path := receive(t, f); path != "/a" {
+		t.Errorf("got %q, want /a", path)
+	}
+
+	f.Stop()
+	f.Set("/after")
+	if f.Current() != "/a" {
+		t.Errorf("Current() = %q after Stop, want /a", f.Current())
+	}
+}
+
+func TestFakeRestartsAfterContextEnds(t *testing.T) {
+	f := NewFake()
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := f.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Health().Running {
+		t.Fatal("not running after Start")
+	}
+	cancel()
+	waitStopped(t, f)
+	f.Set("/dropped")
+	if f.Current() != "" {
+		t.Errorf("Current() = %q after ctx ended, want none", f.Current())
+	}
+
+	if err := f.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Stop()
+	f.Set("/b")
+	if path := receive(t, f); path != "/b" {
+		t.Errorf("got %q, want /b", path)
+	}
+}
+
+func TestPollingFollowsFake(t *testing.T) {
+	f := NewFake()
+	if err := f.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Stop()
+	get := func() (string, error) { return f.Current(), nil }
+	p := NewPolling(get, time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := p.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	f.Set("/a")
+	if path := receive(t, p); path != "/a" {
+		t.Errorf("got %q, want /a", path)
+	}
+
+	// a polling source whose context ended can be started again
+	cancel()
+	waitStopped(t, p)
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+	f.Set("/b")
+	if path := receive(t, p); path != "/b" {
+		t.Errorf("got %q, want /b", path)
+	}
+}
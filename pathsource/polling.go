@@ -0,0 +1,114 @@
+package pathsource
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Polling is a source asking for the folder at a fixed interval.
+type Polling struct {
+	get      func() (string, error)
+	interval time.Duration
+	paths    chan string
+
+	mutex  sync.Mutex
+	cancel context.CancelFunc
+	// runCtx is the context of the running check loop
+	runCtx  context.Context
+	current string
+	health  Health
+}
+
+// NewPolling returns a source calling get every interval, an empty path
+// means there's no folder to report.
+func NewPolling(get func() (string, error), interval time.Duration) *Polling {
+	return newPolling(get, interval, make(chan string))
+}
+
+// newPolling returns a polling source sending to paths, for the sources
+// falling back on polling.
+func newPolling(get func() (string, error), interval time.Duration, paths chan string) *Polling {
+	return &Polling{get: get, interval: interval, paths: paths}
+}
+
+func (p *Polling) Start(ctx context.Context) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.cancel != nil {
+		return nil
+	}
+	ctx, p.cancel = context.WithCancel(ctx)
+	p.runCtx = ctx
+	p.health.Running = true
+	go p.run(ctx)
+	return nil
+}
+
+func (p *Polling) run(ctx context.Context) {
+	defer p.ended(ctx)
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	// checks right away, then on every tick
+	for first := true; ; first = false {
+		if !first {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+
+		path, err := p.get()
+		p.mutex.Lock()
+		p.health.Err, p.health.Checked = err, time.Now()
+		changed := err == nil && path != "" && path != p.current
+		if changed {
+			p.current = path
+		}
+		p.mutex.Unlock()
+
+		if changed {
+			select {
+			case p.paths <- path:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// ended marks the source as stopped when its context is done, so it can be
+// started again, unless it was restarted since.
+func (p *Polling) ended(ctx context.Context) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.runCtx == ctx {
+		p.cancel, p.runCtx = nil, nil
+		p.health.Running = false
+	}
+}
+
+func (p *Polling) Stop() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.cancel != nil {
+		p.cancel()
+		p.cancel = nil
+	}
+	p.health.Running = false
+}
+
+func (p *Polling) Paths() <-chan string { return p.paths }
+
+func (p *Polling) Current() string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.current
+}
+
+func (p *Polling) Health() Health {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.health
+}
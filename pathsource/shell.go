@@ -0,0 +1,119 @@
+package pathsource
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"exputils/config"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// shellInterval is how often the shell is asked for its directory, a shell
+// has no way to tell when it changes.
+const shellInterval = 500 * time.Millisecond
+
+// NewShell returns a source polling the working directory of the shell of
+// the config.
+func NewShell(shell config.Shell) (*Polling, error) {
+	switch shell.Follow {
+	case "tmux":
+		return NewPolling(func() (string, error) { return tmuxPanePath(shell.Target) }, shellInterval), nil
+	case "pid":
+		pid, err := strconv.Atoi(shell.Target)
+		if err != nil || pid <= 0 {
+			return nil, fmt.Errorf("shell to follow has no valid process ID: '%s'", shell.Target)
+		}
+		return NewPolling(func() (string, error) { return processDir(pid) }, shellInterval), nil
+	case "osc7":
+		target := shell.Target
+		if target == "" {
+			target = "cwd.osc7"
+		}
+		path, err := config.Resolve(target)
+		if err != nil {
+			return nil, err
+		}
+		return NewPolling(func() (string, error) { return lastOSC7Path(path) }, shellInterval), nil
+	}
+	return nil, fmt.Errorf("unknown way to follow the shell '%s'", shell.Follow)
+}
+
+// tmuxPanePath asks tmux for the directory of a pane, the active one of the
+// last used session when target is empty.
+func tmuxPanePath(target string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	args := []string{"display-message", "-p"}
+	if target != "" {
+		args = append(args, "-t", target)
+	}
+	cmd := exec.CommandContext(ctx, "tmux", append(args, "#{pane_current_path}")...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("tmux failed: %s", message)
+		}
+		return "", fmt.Errorf("tmux failed: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// lastOSC7Path returns the path of the last OSC 7 report of a file, empty
+// until the shell writes one.
+func lastOSC7Path(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("can't read the shell reports: %w", err)
+	}
+
+	// ESC ] 7 ; file://host/path, ended by BEL or ESC \
+	start := bytes.LastIndex(data, []byte("\x1b]7;"))
+	if start < 0 {
+		return "", nil
+	}
+	report := data[start+len("\x1b]7;"):]
+	if end := bytes.IndexAny(report, "\x07\x1b"); end >= 0 {
+		report = report[:end]
+	} else {
+		// still being written
+		return "", nil
+	}
+
+	u, err := url.Parse(string(report))
+	if err != nil || u.Scheme != "file" {
+		return "", fmt.Errorf("shell report isn't a file URL: '%s'", report)
+	}
+	if !isLocalHost(u.Hostname()) {
+		// a path of another machine, from an SSH session
+		return "", nil
+	}
+	return localPath(u), nil
+}
+
+// isLocalHost reports whether a host of a file URL is this machine, a short
+// name matches the full one.
+func isLocalHost(host string) bool {
+	if host == "" || strings.EqualFold(host, "localhost") {
+		return true
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return false
+	}
+	short := func(name string) string {
+		name, _, _ = strings.Cut(name, ".")
+		return name
+	}
+	return strings.EqualFold(host, hostname) || strings.EqualFold(short(host), short(hostname))
+}
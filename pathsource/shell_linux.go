@@ -0,0 +1,20 @@
+//go:build linux
+
+package pathsource
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+)
+
+// processDir returns the working directory of a process.
+func processDir(pid int) (string, error) {
+	dir, err := os.Readlink(fmt.Sprintf("/proc/%d/cwd", pid))
+	if err != nil {
+		return "", fmt.Errorf("can't read the directory of process %d: %w", pid, err)
+	}
+	return dir, nil
+}
+
+func localPath(u *url.URL) string { return u.Path }
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package pathsource
+
+import (
+	"errors"
+	"net/url"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+func processDir(pid int) (string, error) {
+	return "", errors.New("reading the directory of a process needs Linux")
+}
+
+// localPath turns /C:/Users into C:\Users on Windows.
+func localPath(u *url.URL) string {
+	if runtime.GOOS == "windows" {
+		return filepath.FromSlash(strings.TrimPrefix(u.Path, "/"))
+	}
+	return u.Path
+}
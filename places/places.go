@@ -0,0 +1,108 @@
+// Package places keeps the folders pinned by hand and the ones recently
+// tracked, in a single JSON file.
+package places
+
+import (
+	"encoding/json"
+	"errors"
+	"exputils/config"
+	"exputils/utils"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// maxRecent is how many recent folders are kept, the oldest go first.
+const maxRecent = 20
+
+// Places are the pinned folders, in the order they were pinned, and the
+// recent ones, newest first.
+type Places struct {
+	Pinned []string `json:"pinned"`
+	Recent []Recent `json:"recent"`
+}
+
+// Recent is a folder and when it was last the folder of the tasks.
+type Recent struct {
+	Path string    `json:"path"`
+	Seen time.Time `json:"seen"`
+}
+
+// Path returns the path of the places file.
+func Path() (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "places.json"), nil
+}
+
+var mutex sync.Mutex
+
+// Load returns the places of the file, none if it doesn't exist yet.
+func Load(path string) (Places, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return load(path)
+}
+
+func load(path string) (Places, error) {
+	places := Places{Pinned: []string{}, Recent: []Recent{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return places, nil
+	} else if err != nil {
+		return places, fmt.Errorf("can't read places: %w", err)
+	}
+	if err := json.Unmarshal(data, &places); err != nil {
+		return places, fmt.Errorf("can't parse places: %w", err)
+	}
+	return places, nil
+}
+
+// update applies change to the places of the file and writes them back.
+func update(path string, change func(p *Places)) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	places, err := load(path)
+	if err != nil {
+		return err
+	}
+	change(&places)
+	data, err := json.MarshalIndent(places, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("can't create places directory: %w", err)
+	}
+	if err := utils.WriteFileAtomic(path, data, 0o644); err != nil {
+		return fmt.Errorf("can't write places: %w", err)
+	}
+	return nil
+}
+
+// Visit puts a folder first in the recent ones.
+func Visit(path, folder string, when time.Time) error {
+	return update(path, func(p *Places) {
+		p.Recent = slices.DeleteFunc(p.Recent, func(r Recent) bool { return r.Path == folder })
+		p.Recent = append([]Recent{{folder, when}}, p.Recent...)
+		if len(p.Recent) > maxRecent {
+			p.Recent = p.Recent[:maxRecent]
+		}
+	})
+}
+
+// Pin adds a folder to the pinned ones, or removes it when pinned is false.
+func Pin(path, folder string, pinned bool) error {
+	return update(path, func(p *Places) {
+		p.Pinned = slices.DeleteFunc(p.Pinned, func(f string) bool { return f == folder })
+		if pinned {
+			p.Pinned = append(p.Pinned, folder)
+		}
+	})
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"exputils/history"
+	"exputils/places"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	zone "github.com/lrstanley/bubblezone"
+)
+
+var (
+	// TogglePlacesButton is the divider of the places, clicking it closes
+	// them.
+	TogglePlacesButton = Button{"toggle-places", "Places"}
+	PinFolderButton    = Button{"pin-folder", "Pin Current"}
+	UnpinFolderButton  = Button{"unpin-folder", "Unpin"}
+	ClosePlacesButton  = Button{"close-places", "Close"}
+)
+
+// placesLines is how many places are shown at once.
+const placesLines = 8
+
+// place is a line of the places screen.
+type place struct {
+	path   string
+	pinned bool
+}
+
+// placesScreen lists the pinned folders then the recent ones in place of the
+// warnings, clicking one makes it the folder of the tasks.
+type placesScreen struct {
+	open    bool
+	loading bool
+	places  places.Places
+	// lastRuns are the newest runs by folder, empty without a history
+	lastRuns map[string]history.Run
+	err      error
+	cursor   int
+	// pickErr is why the picked folder can't be used, the warnings are
+	// hidden while the places are shown
+	pickErr error
+}
+
+type PlacesMsg struct {
+	places   places.Places
+	lastRuns map[string]history.Run
+	err      error
+}
+
+// PlacesChangedMsg comes once a folder is visited, pinned or unpinned.
+type PlacesChangedMsg struct{ err error }
+
+// FetchPlaces loads the places with the last run of each, the places come
+// without runs if the history can't be read.
+func FetchPlaces() tea.Msg {
+	path, err := places.Path()
+	if err != nil {
+		return PlacesMsg{err: err}
+	}
+	p, err := places.Load(path)
+	if err != nil {
+		return PlacesMsg{err: err}
+	}
+
+	lastRuns := map[string]history.Run{}
+	if historyPath, err := history.Path(); err == nil {
+		if runs, err := history.Load(historyPath); err == nil {
+			lastRuns = history.LastByFolder(runs)
+		}
+	}
+	return PlacesMsg{p, lastRuns, nil}
+}
+
+// VisitPlace puts a folder first in the recent places.
+func VisitPlace(folder string) tea.Cmd {
+	return func() tea.Msg {
+		path, err := places.Path()
+		if err != nil {
+			return PlacesChangedMsg{err}
+		}
+		return PlacesChangedMsg{places.Visit(path, folder, time.Now())}
+	}
+}
+
+// PinPlace pins or unpins a folder.
+func PinPlace(folder string, pinned bool) tea.Cmd {
+	return func() tea.Msg {
+		path, err := places.Path()
+		if err != nil {
+			return PlacesChangedMsg{err}
+		}
+		return PlacesChangedMsg{places.Pin(path, folder, pinned)}
+	}
+}
+
+// toggle opens or closes the screen, it reloads the places when opened.
+func (p *placesScreen) toggle() tea.Cmd {
+	p.open = !p.open
+	if !p.open {
+		return nil
+	}
+	p.loading = true
+	return FetchPlaces
+}
+
+// refresh reloads the places if the screen is open.
+func (p *placesScreen) refresh() tea.Cmd {
+	if !p.open {
+		return nil
+	}
+	return FetchPlaces
+}
+
+func (p *placesScreen) update(msg PlacesMsg) {
+	p.places, p.lastRuns, p.err, p.loading = msg.places, msg.lastRuns, msg.err, false
+	p.cursor = max(min(p.cursor, len(p.entries())-1), 0)
+}
+
+// entries are the pinned folders, then the recent ones not pinned.
+func (p *placesScreen) entries() []place {
+	entries := []place{}
+	for _, path := range p.places.Pinned {
+		entries = append(entries, place{path, true})
+	}
+	for _, recent := range p.places.Recent {
+		if !slices.Contains(p.places.Pinned, recent.Path) {
+			entries = append(entries, place{recent.Path, false})
+		}
+	}
+	return entries
+}
+
+func (p *placesScreen) selected() (place, bool) {
+	entries := p.entries()
+	if p.cursor >= len(entries) {
+		return place{}, false
+	}
+	return entries[p.cursor], true
+}
+
+func (p *placesScreen) isPinned(path string) bool {
+	return slices.Contains(p.places.Pinned, path)
+}
+
+// handleKey reacts to the places keys, false if the key isn't one of them.
+// Enter uses the selected folder, space pins or unpins it.
+func (p *placesScreen) handleKey(msg tea.KeyMsg) (tea.Cmd, bool) {
+	p.pickErr = nil
+	switch msg.String() {
+	case "up":
+		p.cursor = max(p.cursor-1, 0)
+	case "down":
+		p.cursor = max(min(p.cursor+1, len(p.entries())-1), 0)
+	case "enter":
+		if entry, ok := p.selected(); ok {
+			return CheckFolder(entry.path), true
+		}
+	case " ":
+		if entry, ok := p.selected(); ok {
+			return PinPlace(entry.path, !entry.pinned), true
+		}
+	case "esc":
+		// back to the warnings rather than quitting
+		p.open = false
+	default:
+		return nil, false
+	}
+	return nil, true
+}
+
+// handleClick uses the clicked folder, false if none was clicked.
+func (p *placesScreen) handleClick(msg tea.MouseMsg) (tea.Cmd, bool) {
+	for i, entry := range p.entries() {
+		if zone.Get(fmt.Sprintf("place-%d", i)).InBounds(msg) {
+			p.cursor = i
+			return CheckFolder(entry.path), true
+		}
+	}
+	return nil, false
+}
+
+func (p *placesScreen) title() string {
+	return fmt.Sprintf("Places | %d pinned, %d recent", len(p.places.Pinned), len(p.entries())-len(p.places.Pinned))
+}
+
+// lastRunText tells when a folder was last processed and by which task.
+func (p *placesScreen) lastRunText(path string) string {
+	run, ok := p.lastRuns[filepath.Clean(path)]
+	if !ok {
+		return "never run"
+	}
+	return ago(run.Ended) + ", " + run.TaskID
+}
+
+// ago is how long ago a time was, roughly.
+func ago(t time.Time) string {
+	elapsed := time.Since(t)
+	switch {
+	case elapsed < time.Minute:
+		return "just now"
+	case elapsed < time.Hour:
+		return fmt.Sprintf("%dm ago", int(elapsed.Minutes()))
+	case elapsed < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(elapsed.Hours()))
+	}
+	return fmt.Sprintf("%dd ago", int(elapsed.Hours()/24))
+}
+
+func (p *placesScreen) view() string {
+	style := lipgloss.NewStyle().Foreground(lipgloss.Color("#949494")).PaddingLeft(2).MaxWidth(64)
+	entries := p.entries()
+	switch {
+	case p.err != nil:
+		return style.Render(p.err.Error())
+	case p.loading:
+		return style.Render("loading...")
+	case len(entries) == 0:
+		return style.Render("no places yet, pin the current folder to keep it here")
+	}
+
+	lines := []string{}
+	if p.pickErr != nil {
+		lines = append(lines, style.Foreground(lipgloss.Color("#FF5F5F")).Render(p.pickErr.Error()))
+	}
+	start := max(min(p.cursor-placesLines/2, len(entries)-placesLines), 0)
+	end := min(start+placesLines, len(entries))
+	for i := start; i < end; i++ {
+		prefix := "  "
+		if i == p.cursor {
+			prefix = "> "
+		}
+		mark := "  "
+		if entries[i].pinned {
+			mark = "★ "
+		}
+
+		// keeps the end of long paths, the last run stays on the right
+		lastRun := p.lastRunText(entries[i].path)
+		path := []rune(entries[i].path)
+		if room := 62 - 4 - len(lastRun) - 2; len(path) > room {
+			path = append([]rune("…"), path[len(path)-room+1:]...)
+		}
+		line := prefix + mark + string(path)
+		line += fmt.Sprintf("%*s", 62-lipgloss.Width(line), lastRun)
+
+		lineStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#949494")).MaxWidth(62)
+		if i == p.cursor {
+			lineStyle = lineStyle.Foreground(lipgloss.Color("#FFF7DB")).Bold(true)
+		}
+		lines = append(lines, zone.Mark(fmt.Sprintf("place-%d", i), lineStyle.Render(line)))
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
@@ -0,0 +1,139 @@
+package plugins
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"exputils/procs"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// cancelGracePeriod is how long a plugin has to exit on its own after the
+// "cancel" notification before it's killed.
+const cancelGracePeriod = 5 * time.Second
+
+// conn is a single plugin process, it handles one request at a time.
+type conn struct {
+	cmd    *exec.Cmd
+	stdout *bufio.Scanner
+
+	writeMutex sync.Mutex
+	stdin      io.WriteCloser
+	nextID     int64
+}
+
+func start(ctx context.Context, path string) (*conn, error) {
+	c := &conn{cmd: exec.CommandContext(ctx, path)}
+
+	c.cmd.Cancel = func() error { return c.notify("cancel", nil) }
+	c.cmd.WaitDelay = cancelGracePeriod
+
+	stdin, err := c.cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("can't open plugin stdin: %w", err)
+	}
+	stdout, err := c.cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("can't open plugin stdout: %w", err)
+	}
+	c.stdin = stdin
+	c.stdout = bufio.NewScanner(stdout)
+	c.stdout.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	if err := procs.Start(ctx, c.cmd); err != nil {
+		return nil, fmt.Errorf("can't start plugin: %w", err)
+	}
+	return c, nil
+}
+
+func (c *conn) write(msg message) error {
+	msg.JSONRPC = jsonRPCVersion
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	_, err = c.stdin.Write(append(data, '\n'))
+	return err
+}
+
+func (c *conn) notify(method string, params any) error {
+	msg := message{Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		msg.Params = data
+	}
+	return c.write(msg)
+}
+
+// call sends a request and blocks until its response, passing every
+// notification received in the meantime to onNotify.
+func (c *conn) call(method string, params any, result any, onNotify func(method string, params json.RawMessage)) error {
+	c.nextID++
+	id := c.nextID
+
+	msg := message{ID: &id, Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		msg.Params = data
+	}
+	if err := c.write(msg); err != nil {
+		return fmt.Errorf("can't send '%s' to plugin: %w", method, err)
+	}
+
+	for c.stdout.Scan() {
+		var incoming message
+		if err := json.Unmarshal(c.stdout.Bytes(), &incoming); err != nil {
+			return fmt.Errorf("plugin sent invalid JSON: %w", err)
+		}
+
+		switch {
+		case incoming.ID == nil && incoming.Method != "":
+			if onNotify != nil {
+				onNotify(incoming.Method, incoming.Params)
+			}
+		case incoming.ID != nil && *incoming.ID == id:
+			if incoming.Error != nil {
+				return incoming.Error
+			}
+			if result == nil || len(incoming.Result) == 0 {
+				return nil
+			}
+			if err := json.Unmarshal(incoming.Result, result); err != nil {
+				return fmt.Errorf("plugin sent invalid '%s' result: %w", method, err)
+			}
+			return nil
+		}
+	}
+	if err := c.stdout.Err(); err != nil {
+		return fmt.Errorf("can't read from plugin: %w", err)
+	}
+	return errors.New("plugin exited before responding")
+}
+
+// close closes stdin, which tells the plugin to exit, and waits for it.
+func (c *conn) close() error {
+	c.writeMutex.Lock()
+	c.stdin.Close()
+	c.writeMutex.Unlock()
+
+	err := procs.Wait(c.cmd)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return fmt.Errorf("plugin exited with code %d", exitErr.ExitCode())
+	}
+	return err
+}
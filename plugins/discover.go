@@ -0,0 +1,193 @@
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"exputils/tasks"
+	"exputils/undolog"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const describeTimeout = 5 * time.Second
+
+// Discover asks every executable in dir for its tasks. A plugin that fails
+// to describe itself is reported in the returned error and skipped, the
+// tasks of the others are still returned. A missing dir means no plugins.
+func Discover(dir string) ([]tasks.Task, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("can't read plugins directory: %w", err)
+	}
+
+	discovered := []tasks.Task{}
+	errs := []error{}
+	for _, entry := range entries {
+		if entry.IsDir() || !isExecutable(entry) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+
+		infos, err := describe(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("plugin '%s': %w", entry.Name(), err))
+			continue
+		}
+		for _, info := range infos {
+			if info.ID == "" || info.Label == "" {
+				errs = append(errs, fmt.Errorf("plugin '%s': task without id or label", entry.Name()))
+				continue
+			}
+			discovered = append(discovered, newTask(path, info))
+		}
+	}
+	return discovered, errors.Join(errs...)
+}
+
+func isExecutable(entry os.DirEntry) bool {
+	if runtime.GOOS == "windows" {
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".exe", ".bat", ".cmd":
+			return true
+		}
+		return false
+	}
+	info, err := entry.Info()
+	return err == nil && info.Mode()&0o111 != 0
+}
+
+func describe(path string) ([]TaskInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), describeTimeout)
+	defer cancel()
+
+	c, err := start(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	var result describeResult
+	callErr := c.call("describe", nil, &result, nil)
+	closeErr := c.close()
+	if callErr != nil {
+		return nil, callErr
+	}
+	if closeErr != nil {
+		return nil, closeErr
+	}
+	return result.Tasks, nil
+}
+
+// newTask wraps a plugin task so it can live in the task registry. Its ID is
+// prefixed with the plugin's file name to keep it apart from built-in tasks.
+func newTask(path string, info TaskInfo) tasks.Task {
+	pluginName := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	return tasks.Task{
+		ID:    pluginName + ":" + info.ID,
+		Label: info.Label,
+		Match: info.Match,
+		Run: func(
+			ctx context.Context,
+			parentDir string,
+			opts tasks.Options,
+			updateProgressBase func(func() float64) func(),
+			sendWarning func(error),
+		) {
+			if err := run(ctx, path, info.ID, parentDir, opts, updateProgressBase, sendWarning); err != nil {
+				sendWarning(fmt.Errorf("%s: %w", pluginName, err))
+			}
+			updateProgressBase(func() float64 { return 1 })()
+		},
+	}
+}
+
+func run(
+	ctx context.Context,
+	path string,
+	taskID string,
+	parentDir string,
+	opts tasks.Options,
+	updateProgressBase func(func() float64) func(),
+	sendWarning func(error),
+) error {
+	c, err := start(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	if opts == nil {
+		opts = tasks.Options{}
+	}
+	params := runParams{Task: taskID, Folder: parentDir, Options: opts}
+	callErr := c.call("run", params, nil, func(method string, raw json.RawMessage) {
+		switch method {
+		case "progress":
+			var p progressParams
+			if err := json.Unmarshal(raw, &p); err != nil {
+				sendWarning(fmt.Errorf("invalid progress notification: %w", err))
+				return
+			}
+			updateProgressBase(func() float64 { return p.Value })()
+		case "warning":
+			var w warningParams
+			if err := json.Unmarshal(raw, &w); err != nil {
+				sendWarning(fmt.Errorf("invalid warning notification: %w", err))
+				return
+			}
+			status := tasks.Status(w.Status)
+			if status == "" {
+				status = tasks.StatusWarning
+			}
+			sendWarning(tasks.Event{File: w.File, Status: status, Message: w.Message})
+		case "file":
+			var f fileParams
+			if err := json.Unmarshal(raw, &f); err != nil {
+				sendWarning(fmt.Errorf("invalid file notification: %w", err))
+				return
+			}
+			if err := recordFile(ctx, parentDir, f); err != nil {
+				sendWarning(err)
+			}
+		}
+	})
+	closeErr := c.close()
+
+	switch {
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case callErr != nil:
+		return callErr
+	default:
+		return closeErr
+	}
+}
+
+// recordFile adds a file reported by the plugin to the undo log of the run.
+func recordFile(ctx context.Context, parentDir string, f fileParams) error {
+	resolve := func(path string) string {
+		if path == "" || filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(parentDir, path)
+	}
+	undoLog := undolog.FromContext(ctx)
+	switch f.Op {
+	case "create":
+		return undoLog.Created(resolve(f.Path))
+	case "rename", "move":
+		if f.From == "" {
+			return fmt.Errorf("file notification for '%s' has no 'from'", f.Path)
+		}
+		if f.Op == "rename" {
+			return undoLog.Renamed(resolve(f.From), resolve(f.Path))
+		}
+		return undoLog.Moved(resolve(f.From), resolve(f.Path))
+	}
+	return fmt.Errorf("unknown file operation '%s'", f.Op)
+}
@@ -0,0 +1,81 @@
+// Package plugins runs out-of-process tasks. A plugin is an executable
+// speaking JSON-RPC 2.0 over its stdin/stdout, one JSON object per line.
+//
+// exputils starts the plugin once with the "describe" request to learn its
+// tasks, then once more for every "run" request:
+//
+//	-> {"jsonrpc":"2.0","id":1,"method":"describe"}
+//	<- {"jsonrpc":"2.0","id":1,"result":{"tasks":[{"id":"upscale","label":"Upscale","match":["*.png"]}]}}
+//
+//	-> {"jsonrpc":"2.0","id":1,"method":"run","params":{"task":"upscale","folder":"D:\\inbox","options":{"scale":"2"}}}
+//	<- {"jsonrpc":"2.0","method":"progress","params":{"value":0.5}}
+//	<- {"jsonrpc":"2.0","method":"warning","params":{"file":"01.png","status":"warning","message":"too small"}}
+//	<- {"jsonrpc":"2.0","method":"file","params":{"op":"create","path":"01@2x.png"}}
+//	<- {"jsonrpc":"2.0","id":1,"result":{}}
+//
+// The "file" notification records a file the plugin created ("create"),
+// renamed ("rename") or moved ("move", with "from" set), so "Undo Last Run"
+// can revert it. Relative paths are resolved against the folder.
+//
+// When the run is cancelled exputils sends the "cancel" notification and
+// kills the plugin if it hasn't exited after a grace period. Anything the
+// plugin writes to stderr is ignored.
+package plugins
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const jsonRPCVersion = "2.0"
+
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int64          `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// TaskInfo is a task declared by a plugin in its "describe" result.
+type TaskInfo struct {
+	ID    string   `json:"id"`
+	Label string   `json:"label"`
+	Match []string `json:"match,omitempty"`
+}
+
+type describeResult struct {
+	Tasks []TaskInfo `json:"tasks"`
+}
+
+type runParams struct {
+	Task    string            `json:"task"`
+	Folder  string            `json:"folder"`
+	Options map[string]string `json:"options"`
+}
+
+type progressParams struct {
+	Value float64 `json:"value"`
+}
+
+type warningParams struct {
+	File    string `json:"file,omitempty"`
+	Status  string `json:"status,omitempty"`
+	Message string `json:"message"`
+}
+
+type fileParams struct {
+	Op   string `json:"op"`
+	Path string `json:"path"`
+	From string `json:"from,omitempty"`
+}
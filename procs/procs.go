@@ -0,0 +1,198 @@
+// Package procs starts the external tools of the tasks at the priority picked
+// in the UI, or the one of the run, and with the memory limit of the run. It
+// keeps track of the running tools, so changing the priority applies to them
+// right away, and records each of them in the run log.
+package procs
+
+import (
+	"bytes"
+	"context"
+	"exputils/runlog"
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Priority is the CPU and IO priority the tools run at.
+type Priority int
+
+const (
+	// Normal runs the tools like any other program.
+	Normal Priority = iota
+	// Background runs the tools below normal CPU priority, and at idle IO
+	// priority where the system supports it, so the desktop stays responsive.
+	Background
+)
+
+func (p Priority) String() string {
+	if p == Background {
+		return "background"
+	}
+	return "normal"
+}
+
+// ParsePriority parses "normal" or "background".
+func ParsePriority(s string) (Priority, error) {
+	switch s {
+	case "normal":
+		return Normal, nil
+	case "background":
+		return Background, nil
+	}
+	return Normal, fmt.Errorf("priority must be 'normal' or 'background', got '%s'", s)
+}
+
+// Limits are applied to every tool started with a context carrying them.
+type Limits struct {
+	// MemoryBytes caps the memory of each tool, 0 is no cap.
+	MemoryBytes uint64
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying the limits.
+func NewContext(ctx context.Context, limits Limits) context.Context {
+	return context.WithValue(ctx, contextKey{}, limits)
+}
+
+func limitsFromContext(ctx context.Context) Limits {
+	limits, _ := ctx.Value(contextKey{}).(Limits)
+	return limits
+}
+
+type priorityKey struct{}
+
+// WithPriority returns a context whose tools run at p, whatever the priority
+// picked in the UI.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+func priorityFromContext(ctx context.Context) (Priority, bool) {
+	p, ok := ctx.Value(priorityKey{}).(Priority)
+	return p, ok
+}
+
+// tracked is a running tool.
+type tracked struct {
+	child   *child
+	log     *runlog.Log
+	started time.Time
+	// pinned is set for the tools started with their own priority, changing
+	// the priority leaves them alone
+	pinned bool
+}
+
+var (
+	mutex    sync.Mutex
+	priority = Normal
+	running  = map[*exec.Cmd]*tracked{}
+)
+
+// CurrentPriority returns the priority new tools start at.
+func CurrentPriority() Priority {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return priority
+}
+
+// SetPriority changes the priority of the running tools and of the ones
+// started later, except the ones of a context with its own priority. It
+// returns the tools that couldn't be changed, raising the priority back may
+// need privileges the user doesn't have.
+func SetPriority(p Priority) []error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	priority = p
+
+	errs := []error{}
+	for cmd, t := range running {
+		if t.pinned {
+			continue
+		}
+		if err := t.child.setPriority(p); err != nil {
+			errs = append(errs, fmt.Errorf("can't set %s priority of '%s': %w", p, cmd.Path, err))
+		}
+	}
+	return errs
+}
+
+// Start starts cmd at the priority of ctx, the current one if it has none,
+// with the limits of ctx, and records it in the run log of ctx once it ends.
+// The command must be waited for with Wait, not cmd.Wait, so it stops being
+// tracked. The tool is killed if the priority or the limits can't be applied.
+func Start(ctx context.Context, cmd *exec.Cmd) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	p, pinned := priorityFromContext(ctx)
+	if !pinned {
+		p = priority
+	}
+	limits := limitsFromContext(ctx)
+	log, started := runlog.FromContext(ctx), time.Now()
+	prepare(cmd, p, limits)
+	if err := cmd.Start(); err != nil {
+		log.Command(runlog.Command{Args: cmd.Args, Dir: cmd.Dir, Started: started, Err: err})
+		return err
+	}
+	c, err := attach(cmd.Process.Pid, p, limits)
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		err = fmt.Errorf("can't apply %s priority and limits to '%s': %w", p, cmd.Path, err)
+		log.Command(runlog.Command{Args: cmd.Args, Dir: cmd.Dir, Started: started, Err: err})
+		return err
+	}
+	running[cmd] = &tracked{child: c, log: log, started: started, pinned: pinned}
+	return nil
+}
+
+// Wait waits for a command started with Start.
+func Wait(cmd *exec.Cmd) error {
+	return wait(cmd, nil)
+}
+
+// wait waits for the command and logs it with its output, nil when the
+// output wasn't captured.
+func wait(cmd *exec.Cmd, output *bytes.Buffer) error {
+	err := cmd.Wait()
+
+	mutex.Lock()
+	t, ok := running[cmd]
+	if ok {
+		t.child.release()
+		delete(running, cmd)
+	}
+	mutex.Unlock()
+
+	if ok {
+		logged := runlog.Command{
+			Args:     cmd.Args,
+			Dir:      cmd.Dir,
+			Started:  t.started,
+			Duration: time.Since(t.started),
+			Err:      err,
+		}
+		if output != nil {
+			// not nil when empty, so it's logged as captured
+			logged.Output = append([]byte{}, output.Bytes()...)
+		}
+		t.log.Command(logged)
+	}
+	return err
+}
+
+// CombinedOutput is cmd.CombinedOutput with Start and Wait, the output is
+// also written to the run log.
+func CombinedOutput(ctx context.Context, cmd *exec.Cmd) ([]byte, error) {
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := Start(ctx, cmd); err != nil {
+		return nil, err
+	}
+	err := wait(cmd, &output)
+	return output.Bytes(), err
+}
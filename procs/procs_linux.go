@@ -0,0 +1,78 @@
+//go:build linux
+
+package procs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	backgroundNice = 10
+
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+	// ioprioClassIdle only gets disk time when no one else needs it, class
+	// none follows the CPU nice value
+	ioprioClassIdle = 3
+	ioprioClassNone = 0
+)
+
+// child is a started tool, by pid.
+type child struct{ pid int }
+
+func prepare(cmd *exec.Cmd, p Priority, limits Limits) {}
+
+// attach applies the priority and the memory limit right after the start,
+// before the tool spawns its worker threads, which inherit the nice value.
+func attach(pid int, p Priority, limits Limits) (*child, error) {
+	c := &child{pid}
+	if limits.MemoryBytes > 0 {
+		limit := unix.Rlimit{Cur: limits.MemoryBytes, Max: limits.MemoryBytes}
+		if err := unix.Prlimit(pid, unix.RLIMIT_AS, &limit, nil); err != nil {
+			return nil, fmt.Errorf("can't set memory limit: %w", err)
+		}
+	}
+	if p != Normal {
+		if err := c.setPriority(p); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// setPriority sets the nice value of every thread, Linux keeps one per
+// thread, and the IO priority of the process.
+func (c *child) setPriority(p Priority) error {
+	nice, ioprio := 0, ioprioClassNone<<ioprioClassShift
+	if p == Background {
+		nice, ioprio = backgroundNice, ioprioClassIdle<<ioprioClassShift
+	}
+
+	threads, err := os.ReadDir(fmt.Sprintf("/proc/%d/task", c.pid))
+	if err != nil {
+		return err
+	}
+	errs := []error{}
+	for _, thread := range threads {
+		tid, err := strconv.Atoi(thread.Name())
+		if err != nil {
+			continue
+		}
+		// the thread may have exited since
+		if err := unix.Setpriority(unix.PRIO_PROCESS, tid, nice); err != nil && !errors.Is(err, unix.ESRCH) {
+			errs = append(errs, err)
+		}
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(c.pid), uintptr(ioprio)); errno != 0 {
+		errs = append(errs, errno)
+	}
+	return errors.Join(errs...)
+}
+
+func (c *child) release() {}
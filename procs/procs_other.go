@@ -0,0 +1,40 @@
+//go:build !linux && !windows
+
+package procs
+
+import (
+	"errors"
+	"os/exec"
+
+	"golang.org/x/sys/unix"
+)
+
+const backgroundNice = 10
+
+// child is a started tool, by pid.
+type child struct{ pid int }
+
+func prepare(cmd *exec.Cmd, p Priority, limits Limits) {}
+
+func attach(pid int, p Priority, limits Limits) (*child, error) {
+	if limits.MemoryBytes > 0 {
+		return nil, errors.New("memory limits aren't supported on this system")
+	}
+	c := &child{pid}
+	if p != Normal {
+		if err := c.setPriority(p); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *child) setPriority(p Priority) error {
+	nice := 0
+	if p == Background {
+		nice = backgroundNice
+	}
+	return unix.Setpriority(unix.PRIO_PROCESS, c.pid, nice)
+}
+
+func (c *child) release() {}
@@ -0,0 +1,129 @@
+//go:build windows
+
+package procs
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// child is a started tool, the handle keeps its pid from being reused.
+type child struct {
+	handle windows.Handle
+	// job holds a tool with a memory limit, closing it kills what's left
+	job windows.Handle
+}
+
+func priorityClass(p Priority) uint32 {
+	if p == Background {
+		return windows.BELOW_NORMAL_PRIORITY_CLASS
+	}
+	return windows.NORMAL_PRIORITY_CLASS
+}
+
+// prepare sets the priority class at creation, so the tool never runs at
+// normal priority. A tool with a memory limit starts suspended, attach
+// resumes it once it's in its job.
+func prepare(cmd *exec.Cmd, p Priority, limits Limits) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags &^= windows.BELOW_NORMAL_PRIORITY_CLASS | windows.NORMAL_PRIORITY_CLASS | windows.CREATE_SUSPENDED
+	cmd.SysProcAttr.CreationFlags |= priorityClass(p)
+	if limits.MemoryBytes > 0 {
+		cmd.SysProcAttr.CreationFlags |= windows.CREATE_SUSPENDED
+	}
+}
+
+// attach puts the tool in a job object capping its memory, before it runs
+// anything, then resumes it. The tool and the processes it started are
+// killed when the job is closed, on release or if exputils dies.
+func attach(pid int, p Priority, limits Limits) (*child, error) {
+	handle, err := windows.OpenProcess(
+		windows.PROCESS_SET_INFORMATION|windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE|windows.PROCESS_QUERY_LIMITED_INFORMATION,
+		false,
+		uint32(pid),
+	)
+	if err != nil {
+		return nil, err
+	}
+	c := &child{handle: handle}
+	if limits.MemoryBytes == 0 {
+		return c, nil
+	}
+
+	c.job, err = windows.CreateJobObject(nil, nil)
+	if err != nil {
+		c.release()
+		return nil, fmt.Errorf("can't create job object: %w", err)
+	}
+
+	info := windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION{ProcessMemoryLimit: uintptr(limits.MemoryBytes)}
+	info.BasicLimitInformation.LimitFlags = windows.JOB_OBJECT_LIMIT_PROCESS_MEMORY | windows.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE
+	if _, err := windows.SetInformationJobObject(
+		c.job,
+		windows.JobObjectExtendedLimitInformation,
+		uintptr(unsafe.Pointer(&info)),
+		uint32(unsafe.Sizeof(info)),
+	); err != nil {
+		c.release()
+		return nil, fmt.Errorf("can't set memory limit: %w", err)
+	}
+	if err := windows.AssignProcessToJobObject(c.job, handle); err != nil {
+		c.release()
+		return nil, fmt.Errorf("can't set memory limit: %w", err)
+	}
+	if err := resume(pid); err != nil {
+		c.release()
+		return nil, fmt.Errorf("can't resume: %w", err)
+	}
+	return c, nil
+}
+
+// resume resumes a process created suspended, it only has its main thread
+// until then.
+func resume(pid int) error {
+	snapshot, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPTHREAD, 0)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(snapshot)
+
+	resumed := false
+	entry := windows.ThreadEntry32{Size: uint32(unsafe.Sizeof(windows.ThreadEntry32{}))}
+	for err = windows.Thread32First(snapshot, &entry); err == nil; err = windows.Thread32Next(snapshot, &entry) {
+		if entry.OwnerProcessID != uint32(pid) {
+			continue
+		}
+		thread, err := windows.OpenThread(windows.THREAD_SUSPEND_RESUME, false, entry.ThreadID)
+		if err != nil {
+			return err
+		}
+		_, err = windows.ResumeThread(thread)
+		windows.CloseHandle(thread)
+		if err != nil {
+			return err
+		}
+		resumed = true
+	}
+	if !resumed {
+		return errors.New("no thread to resume")
+	}
+	return nil
+}
+
+func (c *child) setPriority(p Priority) error {
+	return windows.SetPriorityClass(c.handle, priorityClass(p))
+}
+
+func (c *child) release() {
+	if c.job != 0 {
+		windows.CloseHandle(c.job)
+	}
+	windows.CloseHandle(c.handle)
+}
@@ -0,0 +1,114 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"exputils/utils"
+	"html/template"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+func (r Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// WriteCSV writes a row per file, the totals go in a last row with the task
+// and folder as input.
+func (r Report) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"input", "output", "status", "inputSize", "outputSize", "durationMs", "message"})
+	for _, row := range r.Files {
+		writer.Write([]string{
+			row.Input,
+			row.Output,
+			row.Status,
+			strconv.FormatInt(row.InputSize, 10),
+			strconv.FormatInt(row.OutputSize, 10),
+			strconv.FormatInt(row.DurationMs, 10),
+			row.Message,
+		})
+	}
+	writer.Write([]string{
+		"total: " + r.TaskID + " on " + r.Folder,
+		"",
+		strconv.Itoa(r.Totals.Files) + " files, " + strconv.Itoa(r.Totals.Failed) + " failed",
+		strconv.FormatInt(r.Totals.InputSize, 10),
+		strconv.FormatInt(r.Totals.OutputSize, 10),
+		strconv.FormatInt(r.Ended.Sub(r.Started).Milliseconds(), 10),
+		"",
+	})
+	writer.Flush()
+	return writer.Error()
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"bytes":    utils.FormatBytes,
+	"time":     func(t time.Time) string { return t.Format("2006-01-02 15:04:05") },
+	"duration": func(r Report) string { return r.Ended.Sub(r.Started).Round(time.Second).String() },
+	"ms":       func(ms int64) string { return (time.Duration(ms) * time.Millisecond).Round(time.Millisecond).String() },
+	"statuses": func(byStatus map[string]int) []string {
+		statuses := []string{}
+		for status := range byStatus {
+			statuses = append(statuses, status)
+		}
+		sort.Strings(statuses)
+		return statuses
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.TaskID}} – {{.Folder}}</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { padding: 0.3em 0.8em; border-bottom: 1px solid #ddd; text-align: left; vertical-align: top; }
+td.n { text-align: right; white-space: nowrap; }
+tr.failed td { background: #fde8e8; }
+.muted { color: #777; }
+</style>
+</head>
+<body>
+<h1>{{.TaskID}}</h1>
+<p>{{.Folder}}<br>
+<span class="muted">{{time .Started}} to {{time .Ended}}, {{duration .}}{{if .Canceled}}, canceled{{end}}</span></p>
+
+<table>
+<tr><th>Files</th><td class="n">{{.Totals.Files}}</td></tr>
+{{- range $status := statuses .Totals.ByStatus}}
+<tr><th>{{$status}}</th><td class="n">{{index $.Totals.ByStatus $status}}</td></tr>
+{{- end}}
+<tr><th>Input size</th><td class="n">{{bytes .Totals.InputSize}}</td></tr>
+<tr><th>Output size</th><td class="n">{{bytes .Totals.OutputSize}}</td></tr>
+</table>
+
+{{if .Files -}}
+<table>
+<tr><th>Input</th><th>Output</th><th>Status</th><th>Input size</th><th>Output size</th><th>Duration</th><th>Message</th></tr>
+{{- range .Files}}
+<tr{{if eq .Status "failed"}} class="failed"{{end}}><td>{{.Input}}</td><td>{{.Output}}</td><td>{{.Status}}</td><td class="n">{{bytes .InputSize}}</td><td class="n">{{if .Output}}{{bytes .OutputSize}}{{end}}</td><td class="n">{{if .DurationMs}}{{ms .DurationMs}}{{end}}</td><td>{{.Message}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+
+{{if .Messages -}}
+<h2>Messages</h2>
+<ul>
+{{- range .Messages}}
+<li>{{.}}</li>
+{{- end}}
+</ul>
+{{- end}}
+</body>
+</html>
+`))
+
+// WriteHTML writes a self-contained page, styles included.
+func (r Report) WriteHTML(w io.Writer) error {
+	return htmlTemplate.Execute(w, r)
+}
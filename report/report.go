@@ -0,0 +1,180 @@
+// Package report turns the events of a task run into a report with a row per
+// file and run-level totals, that can be saved as JSON, CSV or HTML.
+package report
+
+import (
+	"errors"
+	"exputils/tasks"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Row is the result of a single file.
+type Row struct {
+	Input      string `json:"input"`
+	Output     string `json:"output,omitempty"`
+	Status     string `json:"status"`
+	InputSize  int64  `json:"inputSize"`
+	OutputSize int64  `json:"outputSize"`
+	DurationMs int64  `json:"durationMs"`
+	Message    string `json:"message,omitempty"`
+}
+
+// Totals sum up the rows of a run.
+type Totals struct {
+	Files      int            `json:"files"`
+	Failed     int            `json:"failed"`
+	ByStatus   map[string]int `json:"byStatus"`
+	InputSize  int64          `json:"inputSize"`
+	OutputSize int64          `json:"outputSize"`
+	// Messages is the number of messages not about a single file.
+	Messages int `json:"messages"`
+}
+
+// Report is a finished run.
+type Report struct {
+	TaskID  string    `json:"taskId"`
+	Folder  string    `json:"folder"`
+	Started time.Time `json:"started"`
+	Ended   time.Time `json:"ended"`
+	// Canceled is set when the run was stopped before the end.
+	Canceled bool     `json:"canceled"`
+	Totals   Totals   `json:"totals"`
+	Files    []Row    `json:"files"`
+	Messages []string `json:"messages"`
+}
+
+// Builder collects the events of a run as they're sent.
+type Builder struct {
+	mutex  sync.Mutex
+	report Report
+}
+
+func NewBuilder(taskID, folder string) *Builder {
+	return &Builder{report: Report{TaskID: taskID, Folder: folder, Started: time.Now(), Files: []Row{}, Messages: []string{}}}
+}
+
+// Add records a warning of the run, events about a file become rows, the
+// rest messages.
+func (b *Builder) Add(warn error) {
+	if warn == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	var event tasks.Event
+	if !errors.As(warn, &event) || event.File == "" {
+		b.report.Messages = append(b.report.Messages, warn.Error())
+		return
+	}
+	b.report.Files = append(b.report.Files, Row{
+		Input:      event.File,
+		Output:     event.Output,
+		Status:     string(event.Status),
+		DurationMs: event.Duration.Milliseconds(),
+		Message:    event.Message,
+	})
+}
+
+// Finish ends the run, reads the sizes of the files and sums them up.
+func (b *Builder) Finish(canceled bool) Report {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	r := b.report
+	r.Ended, r.Canceled = time.Now(), canceled
+	r.Files = append([]Row{}, r.Files...)
+	sort.SliceStable(r.Files, func(i, j int) bool { return r.Files[i].Input < r.Files[j].Input })
+
+	r.Totals = Totals{ByStatus: map[string]int{}, Messages: len(r.Messages)}
+	for i := range r.Files {
+		row := &r.Files[i]
+		row.InputSize = sizeOf(r.Folder, row.Input)
+		if row.Output != "" {
+			row.OutputSize = sizeOf(r.Folder, row.Output)
+		}
+		r.Totals.Files++
+		r.Totals.ByStatus[row.Status]++
+		r.Totals.InputSize += row.InputSize
+		r.Totals.OutputSize += row.OutputSize
+		if row.Status == string(tasks.StatusFailed) {
+			r.Totals.Failed++
+		}
+	}
+	return r
+}
+
+// sizeOf returns the size of a file relative to the folder, 0 if it's gone.
+func sizeOf(folder, path string) int64 {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(folder, path)
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return 0
+	}
+	return info.Size()
+}
+
+// Formats are the formats a report can be saved as.
+var Formats = []string{"json", "csv", "html"}
+
+// Save writes the report in each format to dir, or next to the folder when
+// dir is empty, and returns the written files.
+func (r Report) Save(dir string, formats []string) ([]string, error) {
+	if dir == "" {
+		dir = filepath.Dir(r.Folder)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("can't create reports directory: %w", err)
+	}
+	base := fmt.Sprintf(
+		"%s-%s-%s",
+		filepath.Base(r.Folder), sanitize(r.TaskID), r.Started.Format("20060102-150405"),
+	)
+
+	written := []string{}
+	for _, format := range formats {
+		var write func(*os.File) error
+		switch strings.ToLower(format) {
+		case "json":
+			write = func(f *os.File) error { return r.WriteJSON(f) }
+		case "csv":
+			write = func(f *os.File) error { return r.WriteCSV(f) }
+		case "html":
+			write = func(f *os.File) error { return r.WriteHTML(f) }
+		default:
+			return written, fmt.Errorf("unknown report format '%s', must be one of %s", format, strings.Join(Formats, ", "))
+		}
+
+		path := filepath.Join(dir, base+".report."+strings.ToLower(format))
+		file, err := os.Create(path)
+		if err != nil {
+			return written, fmt.Errorf("can't create report: %w", err)
+		}
+		err = write(file)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return written, fmt.Errorf("can't write report '%s': %w", filepath.Base(path), err)
+		}
+		written = append(written, path)
+	}
+	return written, nil
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>| `, r) {
+			return '_'
+		}
+		return r
+	}, s)
+}
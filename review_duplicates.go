@@ -0,0 +1,131 @@
+package main
+
+import (
+	"exputils/tasks"
+	"exputils/utils"
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	zone "github.com/lrstanley/bubblezone"
+)
+
+var (
+	MoveDuplicatesButton    = Button{"move-duplicates", "To " + tasks.DuplicatesDir}
+	TrashDuplicatesButton   = Button{"trash-duplicates", "To Trash"}
+	DismissDuplicatesButton = Button{"dismiss-duplicates", "Dismiss"}
+)
+
+// reviewLines is how many files of the review list are shown at once.
+const reviewLines = 8
+
+// duplicatesReview is the list of duplicate groups found by the Duplicates
+// task, where the keeper of each group is picked before resolving them.
+type duplicatesReview struct {
+	dir    string
+	groups []tasks.DuplicateGroup
+	// cursor indexes the files of all groups, one after the other
+	cursor int
+}
+
+func (r *duplicatesReview) active() bool { return len(r.groups) > 0 }
+
+func (r *duplicatesReview) fileCount() int {
+	count := 0
+	for _, group := range r.groups {
+		count += len(group.Files)
+	}
+	return count
+}
+
+// locate returns the group and file index of a flat index.
+func (r *duplicatesReview) locate(index int) (int, int) {
+	for g, group := range r.groups {
+		if index < len(group.Files) {
+			return g, index
+		}
+		index -= len(group.Files)
+	}
+	return -1, -1
+}
+
+func (r *duplicatesReview) setKeeper(index int) {
+	if g, f := r.locate(index); g >= 0 {
+		tasks.SetKeeper(r.groups, g, f)
+	}
+}
+
+// handleKey reacts to the review keys, false if the key isn't one of them.
+func (r *duplicatesReview) handleKey(msg tea.KeyMsg) bool {
+	switch msg.String() {
+	case "up":
+		r.cursor = max(r.cursor-1, 0)
+	case "down":
+		r.cursor = min(r.cursor+1, r.fileCount()-1)
+	case " ", "enter":
+		r.setKeeper(r.cursor)
+	default:
+		return false
+	}
+	return true
+}
+
+// handleClick picks the clicked file as keeper, false if none was clicked.
+func (r *duplicatesReview) handleClick(msg tea.MouseMsg) bool {
+	for i := 0; i < r.fileCount(); i++ {
+		if zone.Get(fmt.Sprintf("duplicate-%d", i)).InBounds(msg) {
+			r.cursor = i
+			r.setKeeper(i)
+			return true
+		}
+	}
+	return false
+}
+
+func (r *duplicatesReview) view() string {
+	lines := []string{}
+	cursorLine := 0
+	index := 0
+	for _, group := range r.groups {
+		kind := "similar images"
+		if group.Exact {
+			kind = "identical files"
+		}
+		lines = append(lines, lipgloss.NewStyle().Foreground(lipgloss.Color("#666565")).Render("  "+kind))
+
+		for f, file := range group.Files {
+			if index == r.cursor {
+				cursorLine = len(lines)
+			}
+
+			var sb strings.Builder
+			if index == r.cursor {
+				sb.WriteString("> ")
+			} else {
+				sb.WriteString("  ")
+			}
+			if f == group.Keeper {
+				sb.WriteString("[keep] ")
+			} else {
+				sb.WriteString("[move] ")
+			}
+			sb.WriteString(file.Name)
+			if file.Width > 0 {
+				sb.WriteString(fmt.Sprintf("  %dx%d", file.Width, file.Height))
+			}
+			sb.WriteString("  " + utils.FormatBytes(file.Size))
+
+			style := lipgloss.NewStyle().Foreground(lipgloss.Color("#949494")).MaxWidth(62)
+			if f == group.Keeper {
+				style = style.Foreground(lipgloss.Color("#FFF7DB"))
+			}
+			lines = append(lines, zone.Mark(fmt.Sprintf("duplicate-%d", index), style.Render(sb.String())))
+			index++
+		}
+	}
+
+	start := max(min(cursorLine-reviewLines/2, len(lines)-reviewLines), 0)
+	end := min(start+reviewLines, len(lines))
+	return lipgloss.JoinVertical(lipgloss.Left, lines[start:end]...)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"exputils/config"
+	"exputils/history"
+	"exputils/report"
+	"exputils/runlog"
+	"exputils/tasks"
+	"exputils/webhook"
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// ExportReportButton is the progress divider once a run has finished,
+// clicking it saves the report of the run.
+var ExportReportButton = Button{"export-report", "Export Report"}
+
+// reportChan gets the report of every finished run.
+var reportChan = make(chan report.Report)
+
+type ReportMsg struct{ report report.Report }
+
+func FetchReport() tea.Msg { return ReportMsg{<-reportChan} }
+
+// recordRun returns a sendWarning that also adds to the report of the run,
+// and the function ending the run, which saves it to the history and sends
+// its report. The run log is taken from the context. The webhooks are told
+// when the run starts and ends.
+func recordRun(
+	taskID, folder string,
+	opts tasks.Options,
+	sendWarning func(error),
+) (func(error), func(ctx context.Context)) {
+	builder := report.NewBuilder(taskID, folder)
+	webhooks.Send(webhook.StartPayload(taskID, folder, time.Now()))
+	collect := func(warn error) {
+		builder.Add(warn)
+		sendWarning(warn)
+	}
+	finish := func(ctx context.Context) {
+		r := builder.Finish(ctx.Err() != nil)
+		run := history.Run{
+			Report:  r,
+			Options: opts,
+			LogPath: runlog.FromContext(ctx).Path(),
+			Outcome: history.OutcomeOf(r),
+		}
+		if path, err := history.Path(); err != nil {
+			sendWarning(fmt.Errorf("run won't be in the history: %w", err))
+		} else if err := history.Append(path, run); err != nil {
+			sendWarning(err)
+		}
+		webhooks.Send(webhook.EndPayload(r))
+		reportChan <- r
+	}
+	return collect, finish
+}
+
+// exportReport saves the report in the formats and directory of the config,
+// and tells where in the warnings.
+func exportReport(r report.Report, cfg config.Config) {
+	dir := ""
+	if cfg.ReportsDir != "" {
+		var err error
+		if dir, err = config.Resolve(cfg.ReportsDir); err != nil {
+			warnChan <- err
+			return
+		}
+	}
+	formats := cfg.ReportFormats
+	if len(formats) == 0 {
+		formats = report.Formats
+	}
+	written, err := r.Save(dir, formats)
+	if err != nil {
+		warnChan <- err
+	}
+	if len(written) > 0 {
+		warnChan <- tasks.Event{Message: "report saved to " + strings.Join(written, ", ")}
+	}
+}
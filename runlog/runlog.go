@@ -0,0 +1,291 @@
+// Package runlog writes a log file for every task run, with the command line,
+// exit code, duration and full output of each tool the run started and the
+// messages it reported.
+package runlog
+
+import (
+	"context"
+	"errors"
+	"exputils/config"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Dir returns the directory the run logs are kept in.
+func Dir() (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "logs"), nil
+}
+
+// Log is the log of a single run. A nil *Log records nothing, so tools and
+// tasks can write to it whether or not they run with one.
+type Log struct {
+	mutex sync.Mutex
+	path  string
+	file  *os.File
+}
+
+// New creates the log of a run in dir, named after its start time, the task
+// and the folder.
+func New(dir, taskID, folder string) (*Log, error) {
+	started := time.Now()
+	name := fmt.Sprintf(
+		"%s-%s-%s.log",
+		started.Format("20060102-150405.000"), sanitize(taskID), sanitize(filepath.Base(folder)),
+	)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("can't create log directory: %w", err)
+	}
+	file, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("can't create run log: %w", err)
+	}
+
+	l := &Log{path: file.Name(), file: file}
+	header := fmt.Sprintf(
+		"task:    %s\nfolder:  %s\nstarted: %s\n",
+		taskID, folder, started.Format("2006-01-02 15:04:05"),
+	)
+	if err := l.write(header); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>| `, r) {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// Path returns the path of the log file, empty for a nil log.
+func (l *Log) Path() string {
+	if l == nil {
+		return ""
+	}
+	return l.path
+}
+
+func (l *Log) write(s string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.file == nil {
+		return errors.New("run log is closed")
+	}
+	if _, err := l.file.WriteString(s); err != nil {
+		return fmt.Errorf("can't write run log: %w", err)
+	}
+	return nil
+}
+
+// Command is a finished tool.
+type Command struct {
+	Args     []string
+	Dir      string
+	Started  time.Time
+	Duration time.Duration
+	// Err is the error of the tool, nil when it exited with code 0.
+	Err error
+	// Output is the combined stdout and stderr, nil when the output wasn't
+	// captured, like the protocol of a plugin.
+	Output []byte
+}
+
+// Command records a finished tool, its output is written as a block of its
+// own after the command line.
+func (l *Log) Command(c Command) error {
+	if l == nil {
+		return nil
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\n== %s %s\n", c.Started.Format("15:04:05.000"), strings.Join(quoteArgs(c.Args), " "))
+	if c.Dir != "" {
+		fmt.Fprintf(&sb, "in %s\n", c.Dir)
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case c.Err == nil:
+		fmt.Fprintf(&sb, "exit code 0 after %s\n", c.Duration.Round(time.Millisecond))
+	case errors.As(c.Err, &exitErr):
+		fmt.Fprintf(&sb, "exit code %d after %s\n", exitErr.ExitCode(), c.Duration.Round(time.Millisecond))
+	default:
+		// it didn't start, or was killed
+		fmt.Fprintf(&sb, "failed: %s\n", c.Err)
+		if c.Output == nil {
+			return l.write(sb.String())
+		}
+	}
+
+	switch {
+	case c.Output == nil:
+		sb.WriteString("(output not captured)\n")
+	case len(c.Output) == 0:
+		sb.WriteString("(no output)\n")
+	default:
+		sb.Write(c.Output)
+		if c.Output[len(c.Output)-1] != '\n' {
+			sb.WriteString("\n")
+		}
+	}
+	return l.write(sb.String())
+}
+
+func quoteArgs(args []string) []string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\"'") {
+			arg = `"` + strings.ReplaceAll(arg, `"`, `\"`) + `"`
+		}
+		quoted[i] = arg
+	}
+	return quoted
+}
+
+// Message records something the run reported.
+func (l *Log) Message(msg error) error {
+	if l == nil || msg == nil {
+		return nil
+	}
+	return l.write(fmt.Sprintf("\n-- %s %s\n", time.Now().Format("15:04:05.000"), msg))
+}
+
+// Close writes when the run ended and closes the file.
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.write(fmt.Sprintf("\nended:   %s\n", time.Now().Format("2006-01-02 15:04:05")))
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// FindFile returns the index of the line starting the first command block
+// with an argument naming file, or of the first message about it when no
+// tool got it, -1 if there's none. file can be a name or a relative path.
+func FindFile(lines []string, file string) int {
+	message := -1
+	for i, line := range lines {
+		if rest, ok := strings.CutPrefix(line, "== "); ok {
+			// the time comes before the command line
+			_, command, _ := strings.Cut(rest, " ")
+			for _, arg := range splitArgs(command) {
+				if namesFile(arg, file) {
+					return i
+				}
+			}
+		} else if rest, ok := strings.CutPrefix(line, "-- "); ok && message < 0 {
+			_, msg, _ := strings.Cut(rest, " ")
+			if strings.HasPrefix(msg, file+":") || strings.HasPrefix(msg, file+" -> ") {
+				message = i
+			}
+		}
+	}
+	return message
+}
+
+// splitArgs splits a command line written by Command back into arguments.
+func splitArgs(command string) []string {
+	args := []string{}
+	for command = strings.TrimLeft(command, " "); command != ""; command = strings.TrimLeft(command, " ") {
+		if command[0] != '"' {
+			arg, rest, _ := strings.Cut(command, " ")
+			args, command = append(args, arg), rest
+			continue
+		}
+		var sb strings.Builder
+		i := 1
+		for ; i < len(command) && command[i] != '"'; i++ {
+			if command[i] == '\\' && i+1 < len(command) && command[i+1] == '"' {
+				i++
+			}
+			sb.WriteByte(command[i])
+		}
+		args, command = append(args, sb.String()), command[min(i+1, len(command)):]
+	}
+	return args
+}
+
+// namesFile tells whether an argument is the file or a path ending with it.
+func namesFile(arg, file string) bool {
+	return arg == file || strings.HasSuffix(arg, "/"+file) || strings.HasSuffix(arg, `\`+file)
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying the log.
+func NewContext(ctx context.Context, l *Log) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the log of the context, nil if there's none.
+func FromContext(ctx context.Context) *Log {
+	l, _ := ctx.Value(contextKey{}).(*Log)
+	return l
+}
+
+// list returns the log files in dir, oldest first.
+func list(dir string) ([]os.DirEntry, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("can't read log directory: %w", err)
+	}
+	logs := []os.DirEntry{}
+	for _, entry := range entries {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".log" {
+			logs = append(logs, entry)
+		}
+	}
+	sort.Slice(logs, func(i, j int) bool { return logs[i].Name() < logs[j].Name() })
+	return logs, nil
+}
+
+// Last returns the path of the most recent log in dir, empty if there's none.
+func Last(dir string) (string, error) {
+	logs, err := list(dir)
+	if err != nil || len(logs) == 0 {
+		return "", err
+	}
+	return filepath.Join(dir, logs[len(logs)-1].Name()), nil
+}
+
+// Cleanup removes the logs in dir last written more than maxAge ago.
+func Cleanup(dir string, maxAge time.Duration) error {
+	logs, err := list(dir)
+	if err != nil {
+		return err
+	}
+	errs := []error{}
+	for _, entry := range logs {
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) <= maxAge {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("can't remove old log: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -3,19 +3,77 @@ package tasks
 import (
 	"context"
 	"errors"
+	"exputils/imageinfo"
+	"exputils/procs"
+	"exputils/undolog"
 	"exputils/utils"
 	"fmt"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
+type ArtefactOptions struct {
+	Iterations int
+	// Args are passed to artefact as is, after the ones set by the task.
+	Args []string
+	// Globs select the input files.
+	Globs []string
+	// OutputExt picks the output format, artefact infers it from the name.
+	OutputExt string
+	// OutputDir is where the outputs go, relative to the folder. Empty is the
+	// folder itself.
+	OutputDir string
+
+	// Compare reports the PSNR between each input and its output, outputs at
+	// or above CompareThreshold dB are flagged as barely changed.
+	Compare          bool
+	CompareThreshold float64
+}
+
+func ParseArtefactOptions(o Options) (ArtefactOptions, error) {
+	opts := ArtefactOptions{
+		Args:      strings.Fields(o.String("args", "")),
+		OutputExt: strings.ToLower(o.String("outputExt", ".png")),
+		OutputDir: o.String("outputDir", ""),
+	}
+	var err error
+	if opts.Iterations, err = o.Int("iterations", 50); err != nil {
+		return opts, err
+	}
+	if opts.Globs, err = parseGlobs(o, []string{"*.jpg", "*.jpeg", "*.jfif"}); err != nil {
+		return opts, err
+	}
+	if opts.Compare, err = o.Bool("compare", false); err != nil {
+		return opts, err
+	}
+	threshold := o.String("compareThreshold", "50")
+	if opts.CompareThreshold, err = strconv.ParseFloat(threshold, 64); err != nil {
+		return opts, fmt.Errorf("option 'compareThreshold' must be a number, got '%s'", threshold)
+	}
+
+	if !strings.HasPrefix(opts.OutputExt, ".") {
+		opts.OutputExt = "." + opts.OutputExt
+	}
+	switch {
+	case opts.Iterations < 1:
+		return opts, fmt.Errorf("option 'iterations' must be at least 1")
+	case len(opts.OutputExt) < 2 || strings.ContainsAny(opts.OutputExt, `/\:*?"<>|`):
+		return opts, fmt.Errorf("invalid option 'outputExt' '%s'", opts.OutputExt)
+	}
+	return opts, nil
+}
+
 func Artefact(
 	ctx context.Context,
 	parentDir string,
 	poolSize int,
+	opts ArtefactOptions,
 	updateProgressBase func(func() float64) func(),
 	sendWarning func(error),
 ) {
@@ -29,25 +87,41 @@ func Artefact(
 		if entry.IsDir() {
 			continue
 		}
-		if strings.ToLower(filepath.Ext(entry.Name())) == ".jpg" {
+		if matchGlobs(opts.Globs, entry.Name()) {
 			jpgFiles = append(jpgFiles, entry)
 		}
 	}
 
 	if len(jpgFiles) == 0 {
-		sendWarning(fmt.Errorf("no jpg files found"))
+		sendWarning(fmt.Errorf("no files matching %s found", strings.Join(opts.Globs, ", ")))
 		return
 	}
 
+	outputDir := resolveOutputDir(parentDir, opts.OutputDir)
+	outputFileOf := func(fileName string) string {
+		return utils.ReplaceExt(filepath.Join(outputDir, fileName), opts.OutputExt)
+	}
+
+	// a.jpg and a.jpeg would both give a.png
+	outputFiles := []string{}
 	for _, file := range jpgFiles {
-		inputJpgFile := filepath.Join(parentDir, file.Name())
-		outputPngFile := utils.ReplaceExt(inputJpgFile, ".png")
+		outputFile := outputFileOf(file.Name())
 
 		// output file already exists
-		if _, err := os.Stat(outputPngFile); err == nil {
-			sendWarning(fmt.Errorf("possible output file '%s' already exists", outputPngFile))
+		if _, err := os.Stat(outputFile); err == nil {
+			sendWarning(fmt.Errorf("possible output file '%s' already exists", outputFile))
 			return
 		}
+		if utils.Contains(outputFiles, strings.ToLower(outputFile)) {
+			sendWarning(fmt.Errorf("duplicate possible output file for '%s'", file.Name()))
+			return
+		}
+		outputFiles = append(outputFiles, strings.ToLower(outputFile))
+	}
+
+	if err := os.MkdirAll(outputDir, 0o755); err != nil {
+		sendWarning(fmt.Errorf("can't create output directory: %w", err))
+		return
 	}
 
 	processedFiles := 0
@@ -67,30 +141,122 @@ func Artefact(
 			defer updateProgress()
 
 			inputJpgFile := filepath.Join(parentDir, fileName)
-			outputPngFile := utils.ReplaceExt(inputJpgFile, ".png")
+			outputFile := outputFileOf(fileName)
+			started := time.Now()
+			partial := watchOutput(outputFile)
+			failed := func(message string) {
+				if err := partial.record(ctx); err != nil {
+					sendWarning(err)
+				}
+				sendWarning(Event{File: fileName, Status: StatusFailed, Message: message, Duration: time.Since(started)})
+			}
 
-			cmd := exec.CommandContext(ctx, "artefact", inputJpgFile, "-o", outputPngFile, "-i", "50")
-			outputMsgBytes, err := cmd.CombinedOutput()
+			args := append([]string{inputJpgFile, "-o", outputFile, "-i", strconv.Itoa(opts.Iterations)}, opts.Args...)
+			cmd := exec.CommandContext(ctx, "artefact", args...)
+			outputMsgBytes, err := procs.CombinedOutput(ctx, cmd)
 			outputMsgString := string(outputMsgBytes)
 			switch {
 			case err != nil && outputMsgString != "":
-				sendWarning(fmt.Errorf("artefact error: %s", outputMsgString))
+				failed(fmt.Sprintf("artefact error: %s", outputMsgString))
 				return
 			case err != nil && outputMsgString == "":
-				sendWarning(fmt.Errorf("artefact error: %s", err))
+				failed(fmt.Sprintf("artefact error: %s", err))
 				return
 			}
+			duration := time.Since(started)
 
 			// check output file exists
-			_, err = os.Stat(outputPngFile)
+			_, err = os.Stat(outputFile)
 			if errors.Is(err, os.ErrNotExist) {
-				sendWarning(fmt.Errorf("output file '%s' not created", outputPngFile))
+				failed(fmt.Sprintf("output file '%s' not created", outputFile))
+				return
 			} else if err != nil {
-				sendWarning(fmt.Errorf("can't check if output file exists: %w", err))
+				failed(fmt.Sprintf("can't check if output file exists: %s", err))
+				return
 			}
+			if err := undolog.FromContext(ctx).Created(outputFile); err != nil {
+				sendWarning(err)
+			}
+
+			event := Event{File: fileName, Output: relativeOutput(parentDir, outputFile), Status: StatusConverted}
+			if opts.Compare {
+				event = compareArtefactOutput(parentDir, inputJpgFile, outputFile, opts.CompareThreshold)
+			}
+			event.Duration = duration
+			sendWarning(event)
 		})
 	}
 
 	pool.WaitAndClose()
 	updateProgressBase(func() float64 { return 1.0 })()
 }
+
+// artefactBytesPerPixel is the heuristic output size per pixel by extension,
+// the others are assumed to compress like png.
+var artefactBytesPerPixel = map[string]float64{
+	".png":  1.5,
+	".bmp":  3,
+	".ppm":  3,
+	".tif":  3,
+	".tiff": 3,
+}
+
+// EstimateArtefact estimates the size of the Artefact outputs from the pixel
+// count of the inputs, with sample > 0 that many files are processed to
+// correct the estimate.
+func EstimateArtefact(ctx context.Context, parentDir string, opts ArtefactOptions, sample int) (SizeEstimate, error) {
+	inputFiles, err := listMatchingFiles(parentDir, opts.Globs)
+	if err != nil {
+		return SizeEstimate{}, err
+	}
+	bytesPerPixel, ok := artefactBytesPerPixel[opts.OutputExt]
+	if !ok {
+		bytesPerPixel = artefactBytesPerPixel[".png"]
+	}
+
+	e := sizeEstimator{targetDir: resolveOutputDir(parentDir, opts.OutputDir)}
+	for _, inputFile := range inputFiles {
+		info, err := imageinfo.Read(inputFile)
+		if err != nil {
+			// decoded jpgs are about ten times bigger
+			e.files = append(e.files, fileEstimate{inputFile, fileSize(inputFile) * 10})
+			continue
+		}
+		pixels := float64(info.Width) * float64(info.Height)
+		e.files = append(e.files, fileEstimate{inputFile, int64(pixels * bytesPerPixel)})
+	}
+	e.convert = func(ctx context.Context, inputFile, tmpDir string) (string, error) {
+		outputFile := utils.ReplaceExt(filepath.Join(tmpDir, filepath.Base(inputFile)), opts.OutputExt)
+		args := append([]string{inputFile, "-o", outputFile, "-i", strconv.Itoa(opts.Iterations)}, opts.Args...)
+		if output, err := procs.CombinedOutput(ctx, exec.CommandContext(ctx, "artefact", args...)); err != nil {
+			return "", fmt.Errorf("%w: %s", err, output)
+		}
+		return outputFile, nil
+	}
+	return e.estimate(ctx, sample)
+}
+
+// compareArtefactOutput reports how much the output differs from the input,
+// an output that can't be compared is reported as converted.
+func compareArtefactOutput(parentDir, inputFile, outputFile string, threshold float64) Event {
+	event := Event{File: filepath.Base(inputFile), Output: relativeOutput(parentDir, outputFile), Status: StatusCompared}
+
+	psnr, err := psnrFiles(inputFile, outputFile)
+	if err != nil {
+		// the conversion itself went fine
+		event.Status = StatusConverted
+		event.Message = fmt.Sprintf("can't compare: %s", err)
+		return event
+	}
+	if math.IsInf(psnr, 1) {
+		event.Status = StatusUnchanged
+		event.Message = "identical to the input"
+		return event
+	}
+	event.Message = fmt.Sprintf("PSNR %.1f dB", psnr)
+	if psnr >= threshold {
+		event.Status = StatusUnchanged
+		event.Message += ", barely changed"
+	}
+	return event
+}
@@ -0,0 +1,329 @@
+package tasks
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"exputils/undolog"
+	"exputils/utils"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// progressInterval is how many bytes are hashed between progress updates.
+const progressInterval = 8 * 1024 * 1024
+
+// byteProgress turns hashed bytes into progress updates for the whole run.
+type byteProgress struct {
+	mutex          sync.Mutex
+	total, done    int64
+	sinceLastFlush int64
+	updateProgress func()
+}
+
+func newByteProgress(total int64, updateProgressBase func(func() float64) func()) *byteProgress {
+	p := &byteProgress{total: total}
+	p.updateProgress = updateProgressBase(func() float64 {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		if p.total == 0 {
+			return 1
+		}
+		return float64(p.done) / float64(p.total)
+	})
+	return p
+}
+
+func (p *byteProgress) add(n int64) {
+	p.mutex.Lock()
+	p.done += n
+	p.sinceLastFlush += n
+	flush := p.sinceLastFlush >= progressInterval
+	if flush {
+		p.sinceLastFlush = 0
+	}
+	p.mutex.Unlock()
+
+	if flush {
+		p.updateProgress()
+	}
+}
+
+// hashFile streams a file through the algorithm's hash, stopping early when
+// ctx is cancelled.
+func hashFile(ctx context.Context, algorithm checksumAlgorithm, path string, progress *byteProgress) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := algorithm.newHash()
+	buf := make([]byte, 1024*1024)
+	for {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		n, err := file.Read(buf)
+		if n > 0 {
+			hash.Write(buf[:n])
+			progress.add(int64(n))
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// listChecksumInputs returns the files of the directory to put in a manifest,
+// that is all of them except manifests.
+func listChecksumInputs(parentDir string) ([]os.FileInfo, error) {
+	entries, err := os.ReadDir(parentDir)
+	if err != nil {
+		return nil, fmt.Errorf("can't read directory: %w", err)
+	}
+	files := []os.FileInfo{}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if _, ok := detectManifest(entry.Name()); ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("can't stat '%s': %w", entry.Name(), err)
+		}
+		files = append(files, info)
+	}
+	return files, nil
+}
+
+// Checksum writes a manifest with the checksums of every file in the directory.
+func Checksum(
+	ctx context.Context,
+	parentDir string,
+	poolSize int,
+	algorithmName string,
+	updateProgressBase func(func() float64) func(),
+	sendWarning func(error),
+) {
+	algorithm, err := findChecksumAlgorithm(algorithmName)
+	if err != nil {
+		sendWarning(err)
+		return
+	}
+
+	manifestFile := filepath.Join(parentDir, algorithm.fileName(filepath.Base(parentDir)))
+	if _, err := os.Stat(manifestFile); err == nil {
+		sendWarning(fmt.Errorf("manifest '%s' already exists", manifestFile))
+		return
+	}
+
+	files, err := listChecksumInputs(parentDir)
+	if err != nil {
+		sendWarning(err)
+		return
+	}
+	if len(files) == 0 {
+		sendWarning(fmt.Errorf("no files found"))
+		return
+	}
+
+	totalBytes := int64(0)
+	for _, file := range files {
+		totalBytes += file.Size()
+	}
+	progress := newByteProgress(totalBytes, updateProgressBase)
+
+	sums := map[string]string{}
+	failed := false
+	var sumsMutex sync.Mutex
+
+	pool := utils.NewWorkerPool(ctx, poolSize)
+
+	for _, file := range files {
+		fileName := file.Name()
+		pool.Run(func() {
+			sum, err := hashFile(ctx, algorithm, filepath.Join(parentDir, fileName), progress)
+
+			sumsMutex.Lock()
+			defer sumsMutex.Unlock()
+			if err != nil {
+				failed = true
+				if ctx.Err() == nil {
+					sendWarning(fmt.Errorf("can't hash '%s': %w", fileName, err))
+				}
+				return
+			}
+			sums[fileName] = sum
+		})
+	}
+
+	pool.WaitAndClose()
+
+	if ctx.Err() != nil {
+		sendWarning(ctx.Err())
+		return
+	}
+	if failed {
+		sendWarning(fmt.Errorf("manifest not written, some files couldn't be hashed"))
+		return
+	}
+	if err := utils.WriteFileAtomic(manifestFile, algorithm.formatManifest(sums), 0o644); err != nil {
+		sendWarning(fmt.Errorf("can't write manifest: %w", err))
+		return
+	}
+	if err := undolog.FromContext(ctx).Created(manifestFile); err != nil {
+		sendWarning(err)
+	}
+	updateProgressBase(func() float64 { return 1 })()
+}
+
+// ChecksumVerify checks the files of the directory against its manifest and
+// reports missing, changed and extra files. Without a manifest name the one
+// with the preferred algorithm is used.
+func ChecksumVerify(
+	ctx context.Context,
+	parentDir string,
+	poolSize int,
+	manifestName string,
+	updateProgressBase func(func() float64) func(),
+	sendWarning func(error),
+) {
+	if manifestName == "" {
+		entries, err := os.ReadDir(parentDir)
+		if err != nil {
+			sendWarning(fmt.Errorf("can't read directory: %w", err))
+			return
+		}
+		// prefer the algorithms in the order of checksumAlgorithms
+		best := len(checksumAlgorithms)
+		for _, entry := range entries {
+			algorithm, ok := detectManifest(entry.Name())
+			if !ok || !entry.Type().IsRegular() {
+				continue
+			}
+			for i, a := range checksumAlgorithms {
+				if a.name == algorithm.name && i < best {
+					best = i
+					manifestName = entry.Name()
+				}
+			}
+		}
+		if manifestName == "" {
+			sendWarning(fmt.Errorf("no checksum manifest found"))
+			return
+		}
+	}
+
+	algorithm, ok := detectManifest(manifestName)
+	if !ok {
+		sendWarning(fmt.Errorf("unknown manifest format '%s'", manifestName))
+		return
+	}
+	manifest, err := os.Open(filepath.Join(parentDir, manifestName))
+	if err != nil {
+		sendWarning(fmt.Errorf("can't open manifest: %w", err))
+		return
+	}
+	expected, err := algorithm.parseManifest(manifest)
+	manifest.Close()
+	if err != nil {
+		sendWarning(fmt.Errorf("can't parse '%s': %w", manifestName, err))
+		return
+	}
+
+	files, err := listChecksumInputs(parentDir)
+	if err != nil {
+		sendWarning(err)
+		return
+	}
+	onDisk := map[string]os.FileInfo{}
+	for _, file := range files {
+		onDisk[file.Name()] = file
+	}
+
+	totalBytes := int64(0)
+	toHash := []string{}
+	missing := 0
+	for fileName := range expected {
+		if file, ok := onDisk[fileName]; ok {
+			totalBytes += file.Size()
+			toHash = append(toHash, fileName)
+			continue
+		}
+		// manifests can point into subdirectories
+		if info, err := os.Stat(filepath.Join(parentDir, fileName)); err == nil && info.Mode().IsRegular() {
+			totalBytes += info.Size()
+			toHash = append(toHash, fileName)
+			continue
+		}
+		missing++
+		sendWarning(Event{File: fileName, Status: StatusMissing})
+	}
+	sort.Strings(toHash)
+
+	extra := 0
+	for _, file := range files {
+		if _, ok := expected[file.Name()]; !ok {
+			extra++
+			sendWarning(Event{File: file.Name(), Status: StatusExtra, Message: "not in the manifest"})
+		}
+	}
+
+	progress := newByteProgress(totalBytes, updateProgressBase)
+	changed := 0
+	unreadable := []string{}
+	var countMutex sync.Mutex
+
+	pool := utils.NewWorkerPool(ctx, poolSize)
+
+	for _, fileName := range toHash {
+		pool.Run(func() {
+			sum, err := hashFile(ctx, algorithm, filepath.Join(parentDir, fileName), progress)
+			switch {
+			case err != nil && ctx.Err() == nil:
+				countMutex.Lock()
+				unreadable = append(unreadable, fileName)
+				countMutex.Unlock()
+				sendWarning(Event{File: fileName, Status: StatusFailed, Message: fmt.Sprintf("can't hash: %s", err)})
+			case err == nil && sum != expected[fileName]:
+				countMutex.Lock()
+				changed++
+				countMutex.Unlock()
+				sendWarning(Event{File: fileName, Status: StatusChanged, Message: "checksum mismatch"})
+			}
+		})
+	}
+
+	pool.WaitAndClose()
+
+	if ctx.Err() != nil {
+		sendWarning(ctx.Err())
+		return
+	}
+
+	summary := Event{File: manifestName, Status: StatusIntact}
+	if missing > 0 || changed > 0 || extra > 0 || len(unreadable) > 0 {
+		summary.Status = StatusDamaged
+	}
+	summary.Message = fmt.Sprintf(
+		"%d files checked, %d changed, %d missing, %d extra, %d unreadable",
+		len(toHash)-len(unreadable), changed, missing, extra, len(unreadable),
+	)
+	if len(unreadable) > 0 {
+		sort.Strings(unreadable)
+		summary.Message += ": " + strings.Join(unreadable, ", ")
+	}
+	sendWarning(summary)
+	updateProgressBase(func() float64 { return 1 })()
+}
@@ -0,0 +1,151 @@
+package tasks
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// checksumAlgorithm is a supported manifest format.
+type checksumAlgorithm struct {
+	name string
+	// fileName returns the manifest name for the folder.
+	fileName func(folderName string) string
+	newHash  func() hash.Hash
+	sfv      bool
+}
+
+var checksumAlgorithms = []checksumAlgorithm{
+	{
+		name:     "sha256",
+		fileName: func(string) string { return "SHA256SUMS" },
+		newHash:  sha256.New,
+	},
+	{
+		name:     "blake2b",
+		fileName: func(string) string { return "B2SUMS" },
+		newHash: func() hash.Hash {
+			h, _ := blake2b.New512(nil)
+			return h
+		},
+	},
+	{
+		name:     "md5",
+		fileName: func(folderName string) string { return folderName + ".md5" },
+		newHash:  md5.New,
+	},
+	{
+		name:     "sfv",
+		fileName: func(folderName string) string { return folderName + ".sfv" },
+		newHash:  func() hash.Hash { return crc32.NewIEEE() },
+		sfv:      true,
+	},
+}
+
+func findChecksumAlgorithm(name string) (checksumAlgorithm, error) {
+	for _, algorithm := range checksumAlgorithms {
+		if algorithm.name == name {
+			return algorithm, nil
+		}
+	}
+	names := []string{}
+	for _, algorithm := range checksumAlgorithms {
+		names = append(names, algorithm.name)
+	}
+	return checksumAlgorithm{}, fmt.Errorf("unknown checksum algorithm '%s', use one of %s", name, strings.Join(names, ", "))
+}
+
+// detectManifest returns the algorithm of a manifest from its file name.
+func detectManifest(fileName string) (checksumAlgorithm, bool) {
+	switch {
+	case strings.EqualFold(fileName, "SHA256SUMS"), strings.EqualFold(filepath.Ext(fileName), ".sha256"):
+		return checksumAlgorithms[0], true
+	case strings.EqualFold(fileName, "B2SUMS"), strings.EqualFold(filepath.Ext(fileName), ".b2"):
+		return checksumAlgorithms[1], true
+	case strings.EqualFold(fileName, "MD5SUMS"), strings.EqualFold(filepath.Ext(fileName), ".md5"):
+		return checksumAlgorithms[2], true
+	case strings.EqualFold(filepath.Ext(fileName), ".sfv"):
+		return checksumAlgorithms[3], true
+	}
+	return checksumAlgorithm{}, false
+}
+
+// formatManifest writes the checksums in the format of sha256sum and friends,
+// or as an SFV file, sorted by file name.
+func (a checksumAlgorithm) formatManifest(sums map[string]string) []byte {
+	fileNames := make([]string, 0, len(sums))
+	for fileName := range sums {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+
+	var sb strings.Builder
+	if a.sfv {
+		sb.WriteString("; generated by exputils\n")
+	}
+	for _, fileName := range fileNames {
+		if a.sfv {
+			sb.WriteString(fileName + " " + strings.ToUpper(sums[fileName]) + "\n")
+		} else {
+			sb.WriteString(sums[fileName] + " *" + fileName + "\n")
+		}
+	}
+	return []byte(sb.String())
+}
+
+// parseManifest reads a manifest into file name -> lowercase hex checksum.
+func (a checksumAlgorithm) parseManifest(r io.Reader) (map[string]string, error) {
+	sums := map[string]string{}
+	digestLength := a.newHash().Size() * 2
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if lineNumber == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if strings.TrimSpace(line) == "" || (a.sfv && strings.HasPrefix(line, ";")) {
+			continue
+		}
+
+		var fileName, sum string
+		if a.sfv {
+			i := strings.LastIndexByte(line, ' ')
+			if i < 0 {
+				return nil, fmt.Errorf("line %d: expected '<file> <crc32>'", lineNumber)
+			}
+			fileName, sum = strings.TrimSpace(line[:i]), line[i+1:]
+		} else {
+			i := strings.IndexByte(line, ' ')
+			if i < 0 || len(line) < i+2 {
+				return nil, fmt.Errorf("line %d: expected '<checksum> <file>'", lineNumber)
+			}
+			sum = line[:i]
+			// "<sum>  <file>" is text mode, "<sum> *<file>" binary mode
+			fileName = strings.TrimPrefix(line[i+1:], " ")
+			fileName = strings.TrimPrefix(fileName, "*")
+		}
+
+		sum = strings.ToLower(sum)
+		if _, err := hex.DecodeString(sum); err != nil || len(sum) != digestLength {
+			return nil, fmt.Errorf("line %d: invalid %s checksum '%s'", lineNumber, a.name, sum)
+		}
+		sums[filepath.FromSlash(fileName)] = sum
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return sums, nil
+}
@@ -3,6 +3,8 @@ package tasks
 import (
 	"context"
 	"errors"
+	"exputils/procs"
+	"exputils/undolog"
 	"exputils/utils"
 	"fmt"
 	"os"
@@ -10,6 +12,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 )
 
 func Cjxl(
@@ -83,27 +86,64 @@ func Cjxl(
 
 			inputFile := filepath.Join(parentDir, fileName)
 			outputFile := utils.ReplaceExt(inputFile, ".jxl")
+			started := time.Now()
+			partial := watchOutput(outputFile)
+			failed := func(message string) {
+				if err := partial.record(ctx); err != nil {
+					sendWarning(err)
+				}
+				sendWarning(Event{File: fileName, Status: StatusFailed, Message: message, Duration: time.Since(started)})
+			}
 
 			// convert jpg/png to jxl
 			cmd := exec.CommandContext(ctx, "djxl", inputFile, outputFile, "-d", distance, "-e", "9")
-			outputMsgBytes, err := cmd.CombinedOutput()
+			outputMsgBytes, err := procs.CombinedOutput(ctx, cmd)
 			outputMsgString := string(outputMsgBytes)
 			switch {
 			case err != nil && outputMsgString != "":
-				sendWarning(fmt.Errorf("djxl error: %s", outputMsgString))
+				failed(fmt.Sprintf("djxl error: %s", outputMsgString))
 				return
 			case err != nil && outputMsgString == "":
-				sendWarning(fmt.Errorf("djxl error: %w", err))
+				failed(fmt.Sprintf("djxl error: %s", err))
 				return
 			}
+			duration := time.Since(started)
 
 			// check output file exists
 			_, err = os.Stat(outputFile)
 			if errors.Is(err, os.ErrNotExist) {
-				sendWarning(fmt.Errorf("output file '%s' not created", outputFile))
+				failed(fmt.Sprintf("output file '%s' not created", outputFile))
+				return
 			} else if err != nil {
-				sendWarning(fmt.Errorf("can't check if output file exists: %w", err))
+				failed(fmt.Sprintf("can't check if output file exists: %s", err))
+				return
 			}
+			if err := undolog.FromContext(ctx).Created(outputFile); err != nil {
+				sendWarning(err)
+			}
+			sendWarning(Event{File: fileName, Output: relativeOutput(parentDir, outputFile), Status: StatusConverted, Duration: duration})
 		})
 	}
+
+	pool.WaitAndClose()
+	updateProgressBase(func() float64 { return 1 })()
+}
+
+// EstimateCjxl estimates the size of the Cjxl outputs from the usual gains:
+// lossless jpg transcoding saves about 20%, lossless png about 35%.
+func EstimateCjxl(parentDir string, outputLossy bool) (SizeEstimate, error) {
+	inputFiles, err := listMatchingFiles(parentDir, []string{"*.jpg", "*.png"})
+	if err != nil {
+		return SizeEstimate{}, err
+	}
+	ratios := map[string]float64{".jpg": 0.8, ".png": 0.65}
+	if outputLossy {
+		ratios = map[string]float64{".jpg": 0.6, ".png": 0.25}
+	}
+	e := sizeEstimator{targetDir: parentDir}
+	for _, inputFile := range inputFiles {
+		ratio := ratios[strings.ToLower(filepath.Ext(inputFile))]
+		e.files = append(e.files, fileEstimate{inputFile, int64(float64(fileSize(inputFile)) * ratio)})
+	}
+	return e.estimate(context.Background(), 0)
 }
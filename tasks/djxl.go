@@ -3,6 +3,9 @@ package tasks
 import (
 	"context"
 	"errors"
+	"exputils/jxl"
+	"exputils/procs"
+	"exputils/undolog"
 	"exputils/utils"
 	"fmt"
 	"os"
@@ -10,13 +13,185 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 )
 
-// Djxl reconstructs original jpg from jxl files, if possible, else to png.
+type DjxlOptions struct {
+	// Format is "auto", "png", "ppm" or "pfm". Auto rebuilds the original jpg
+	// when the file allows it and decodes to png otherwise, the others always
+	// decode to pixels.
+	Format string
+	// BitsPerSample of the decoded pixels, 0 keeps the source's. It doesn't
+	// apply to reconstructed jpg and pfm, which is always 32-bit float.
+	BitsPerSample int
+	// OutputDir is where the outputs go, relative to the folder. Empty is the
+	// folder itself.
+	OutputDir string
+}
+
+func ParseDjxlOptions(o Options) (DjxlOptions, error) {
+	opts := DjxlOptions{
+		Format:    strings.ToLower(o.String("format", "auto")),
+		OutputDir: o.String("outputDir", ""),
+	}
+	var err error
+	if opts.BitsPerSample, err = o.Int("bitsPerSample", 0); err != nil {
+		return opts, err
+	}
+
+	switch {
+	case !utils.Contains([]string{"auto", "png", "ppm", "pfm"}, opts.Format):
+		return opts, fmt.Errorf("option 'format' must be 'auto', 'png', 'ppm' or 'pfm', got '%s'", opts.Format)
+	case opts.BitsPerSample != 0 && opts.BitsPerSample != 8 && opts.BitsPerSample != 16:
+		return opts, fmt.Errorf("option 'bitsPerSample' must be 8 or 16")
+	case opts.BitsPerSample != 0 && opts.Format == "pfm":
+		return opts, fmt.Errorf("option 'bitsPerSample' doesn't apply to pfm")
+	}
+	return opts, nil
+}
+
+// djxlJob is the decoding of one jxl file, decided before anything runs.
+type djxlJob struct {
+	inputFile  string
+	outputFile string
+	header     jxl.Header
+	// reconstruct is true when the original jpg is rebuilt, false for a
+	// pixel decode
+	reconstruct bool
+	// reason tells why the pixels are decoded
+	reason string
+}
+
+// planDjxl picks the output of a jxl file, the jbrd box tells upfront
+// whether the original jpg can be rebuilt.
+func planDjxl(inputFile, outputDir string, opts DjxlOptions) (djxlJob, error) {
+	jxlFile, err := jxl.ReadFile(inputFile)
+	if err != nil {
+		return djxlJob{}, err
+	}
+
+	job := djxlJob{inputFile: inputFile, header: jxlFile.Header}
+	outputBase := filepath.Join(outputDir, filepath.Base(inputFile))
+	switch {
+	case opts.Format == "auto" && jxlFile.JPEGReconstruction:
+		job.outputFile = utils.ReplaceExt(outputBase, ".jpg")
+		job.reconstruct = true
+		return job, nil
+	case opts.Format == "auto":
+		job.outputFile = utils.ReplaceExt(outputBase, ".png")
+		job.reason = "no JPEG reconstruction data"
+	default:
+		job.outputFile = utils.ReplaceExt(outputBase, "."+opts.Format)
+		if jxlFile.JPEGReconstruction {
+			job.reason = "JPEG reconstruction skipped"
+		}
+	}
+
+	if opts.Format == "ppm" && jxlFile.Header.Alpha {
+		job.reason = strings.TrimPrefix(job.reason+", alpha dropped", ", ")
+	}
+	return job, nil
+}
+
+// args returns the djxl arguments of the job.
+func (job djxlJob) args(opts DjxlOptions) []string {
+	args := []string{job.inputFile, job.outputFile}
+	if !job.reconstruct && opts.BitsPerSample != 0 {
+		args = append(args, fmt.Sprintf("--bits_per_sample=%d", opts.BitsPerSample))
+	}
+	return args
+}
+
+// estimatedBytes is the heuristic size of the output: a rebuilt jpg is a bit
+// bigger than the jxl, decoded pixels are sized from the header.
+func (job djxlJob) estimatedBytes(opts DjxlOptions) int64 {
+	if job.reconstruct {
+		return fileSize(job.inputFile) * 5 / 4
+	}
+
+	channels := int64(3)
+	if job.header.Grayscale {
+		channels = 1
+	}
+	bytesPerSample := int64(1)
+	if opts.BitsPerSample > 8 || (opts.BitsPerSample == 0 && job.header.BitsPerSample > 8) {
+		bytesPerSample = 2
+	}
+	pixels := int64(job.header.Width) * int64(job.header.Height)
+
+	switch opts.Format {
+	case "pfm":
+		return pixels * channels * 4
+	case "ppm":
+		return pixels * channels * bytesPerSample
+	}
+	if job.header.Alpha {
+		channels++
+	}
+	// png deflate usually halves photographic content
+	return pixels * channels * bytesPerSample / 2
+}
+
+// EstimateDjxl estimates the size of the Djxl outputs, with sample > 0 that
+// many files are decoded to correct the estimate.
+func EstimateDjxl(ctx context.Context, parentDir string, opts DjxlOptions, sample int) (SizeEstimate, error) {
+	inputFiles, err := listMatchingFiles(parentDir, []string{"*.jxl"})
+	if err != nil {
+		return SizeEstimate{}, err
+	}
+	outputDir := resolveOutputDir(parentDir, opts.OutputDir)
+	e := sizeEstimator{targetDir: outputDir}
+	jobs := map[string]djxlJob{}
+	for _, inputFile := range inputFiles {
+		job, err := planDjxl(inputFile, outputDir, opts)
+		if err != nil {
+			return SizeEstimate{}, errNoEstimate
+		}
+		jobs[inputFile] = job
+		e.files = append(e.files, fileEstimate{inputFile, job.estimatedBytes(opts)})
+	}
+	e.convert = func(ctx context.Context, inputFile, tmpDir string) (string, error) {
+		job := jobs[inputFile]
+		job.outputFile = filepath.Join(tmpDir, filepath.Base(job.outputFile))
+		if output, err := procs.CombinedOutput(ctx, exec.CommandContext(ctx, "djxl", job.args(opts)...)); err != nil {
+			return "", fmt.Errorf("%w: %s", err, output)
+		}
+		return job.outputFile, nil
+	}
+	return e.estimate(ctx, sample)
+}
+
+// event tells which path the job took, so lossy round trips can be audited.
+func (job djxlJob) event(parentDir string, opts DjxlOptions) Event {
+	event := Event{File: filepath.Base(job.inputFile), Output: relativeOutput(parentDir, job.outputFile)}
+	if job.reconstruct {
+		event.Status = StatusReconstructed
+		event.Message = "reconstructed original JPEG"
+		return event
+	}
+
+	event.Status = StatusDecoded
+	depth := "source bit depth"
+	switch {
+	case opts.Format == "pfm":
+		depth = "32-bit float"
+	case opts.BitsPerSample != 0:
+		depth = fmt.Sprintf("%d-bit", opts.BitsPerSample)
+	}
+	event.Message = fmt.Sprintf("decoded to pixels, %s", depth)
+	if job.reason != "" {
+		event.Message += ", " + job.reason
+	}
+	return event
+}
+
+// Djxl reconstructs original jpg from jxl files, if possible, else decodes
+// them to png, ppm or pfm.
 func Djxl(
 	ctx context.Context,
 	parentDir string,
 	poolSize int,
+	opts DjxlOptions,
 	updateProgressBase func(func() float64) func(),
 	sendWarning func(error),
 ) {
@@ -40,6 +215,8 @@ func Djxl(
 		return
 	}
 
+	outputDir := resolveOutputDir(parentDir, opts.OutputDir)
+
 	processedFiles := 0
 	var progressMutex sync.Mutex
 	updateProgress := updateProgressBase(func() float64 {
@@ -49,94 +226,77 @@ func Djxl(
 		return float64(processedFiles) / float64(len(jxlFiles))
 	})
 
-	pool := utils.NewWorkerPool(ctx, poolSize)
-
+	jobs := []djxlJob{}
 	canContinue := true
 	for _, file := range jxlFiles {
-		inputJxlFile := filepath.Join(parentDir, file.Name())
-		outputPngFile := utils.ReplaceExt(inputJxlFile, ".png")
-		outputJpgFile := utils.ReplaceExt(inputJxlFile, ".jpg")
-
-		// output file already exists
-		if _, err := os.Stat(outputJpgFile); err == nil {
-			sendWarning(fmt.Errorf("possible output file '%s' already exists", outputJpgFile))
+		job, err := planDjxl(filepath.Join(parentDir, file.Name()), outputDir, opts)
+		if err != nil {
+			sendWarning(fmt.Errorf("can't read '%s': %w", file.Name(), err))
 			canContinue = false
+			continue
 		}
-		if _, err := os.Stat(outputPngFile); err == nil {
-			sendWarning(fmt.Errorf("possible output file '%s' already exists", outputPngFile))
+
+		// output file already exists
+		if _, err := os.Stat(job.outputFile); err == nil {
+			sendWarning(fmt.Errorf("possible output file '%s' already exists", job.outputFile))
 			canContinue = false
 		}
+		jobs = append(jobs, job)
 	}
 
 	if !canContinue {
 		return
 	}
 
-	for _, file := range jxlFiles {
-		fileName := file.Name()
-		pool.Run(func() {
-			defer updateProgress()
+	if err := os.MkdirAll(outputDir, 0o755); err != nil {
+		sendWarning(fmt.Errorf("can't create output directory: %w", err))
+		return
+	}
 
-			inputJxlFile := filepath.Join(parentDir, fileName)
-			outputPngFile := utils.ReplaceExt(inputJxlFile, ".png")
-			outputJpgFile := utils.ReplaceExt(inputJxlFile, ".jpg")
+	pool := utils.NewWorkerPool(ctx, poolSize)
 
-			// try reconstruct original jpg
-			cmd := exec.CommandContext(ctx, "djxl", inputJxlFile, outputJpgFile)
-			outputMsgBytes, err := cmd.CombinedOutput()
-			outputMsgString := string(outputMsgBytes)
-			switch {
-			// error with message
-			case err != nil && outputMsgString != "":
-				sendWarning(fmt.Errorf("djxl error: %s", outputMsgString))
-				return
-				// error without message
-			case err != nil && outputMsgString == "":
-				sendWarning(fmt.Errorf("djxl error but didn't output anything"))
-				return
-				// success, reconstructed original jpg
-			case err == nil && !strings.Contains(outputMsgString, "Warning: could not decode losslessly to JPEG"):
-				_, err := os.Stat(outputJpgFile)
-				if errors.Is(err, os.ErrNotExist) {
-					sendWarning(fmt.Errorf("output file '%s' not created", outputJpgFile))
-				} else if err != nil {
-					sendWarning(fmt.Errorf("can't check if output file exists: %w", err))
+	for _, job := range jobs {
+		pool.Run(func() {
+			defer updateProgress()
+			started := time.Now()
+			partial := watchOutput(job.outputFile)
+			failed := func(message string) {
+				if err := partial.record(ctx); err != nil {
+					sendWarning(err)
 				}
-				return
+				sendWarning(Event{File: filepath.Base(job.inputFile), Status: StatusFailed, Message: message, Duration: time.Since(started)})
 			}
 
-			if err := os.Remove(outputJpgFile); err != nil {
-				sendWarning(fmt.Errorf("can't remove output file: %w", err))
-				return
-			}
-
-			// jxl -> png
-			cmd = exec.CommandContext(ctx, "djxl", inputJxlFile, outputPngFile)
-			outputMsgBytes, err = cmd.CombinedOutput()
-			outputMsgString = string(outputMsgBytes)
-
+			cmd := exec.CommandContext(ctx, "djxl", job.args(opts)...)
+			outputMsgBytes, err := procs.CombinedOutput(ctx, cmd)
+			outputMsgString := string(outputMsgBytes)
 			switch {
 			// error with message
 			case err != nil && outputMsgString != "":
-				sendWarning(fmt.Errorf("djxl error: %s", outputMsgString))
+				failed(fmt.Sprintf("djxl error: %s", outputMsgString))
 				return
 			// error without message
 			case err != nil && outputMsgString == "":
-				sendWarning(fmt.Errorf("djxl error but didn't output anything"))
-				return
-			// error expect message not found
-			case err == nil && !strings.Contains(outputMsgString, "Decoded to pixels."):
-				sendWarning(fmt.Errorf("expecting 'Decoded to pixels.' in output: %s", outputMsgString))
+				failed("djxl error but didn't output anything")
 				return
 			}
+			duration := time.Since(started)
 
 			// check output file exists
-			_, err = os.Stat(outputPngFile)
+			_, err = os.Stat(job.outputFile)
 			if errors.Is(err, os.ErrNotExist) {
-				sendWarning(fmt.Errorf("output file '%s' not created", outputPngFile))
+				failed(fmt.Sprintf("output file '%s' not created", job.outputFile))
+				return
 			} else if err != nil {
-				sendWarning(fmt.Errorf("can't check if output file exists: %w", err))
+				failed(fmt.Sprintf("can't check if output file exists: %s", err))
+				return
+			}
+			if err := undolog.FromContext(ctx).Created(job.outputFile); err != nil {
+				sendWarning(err)
 			}
+			event := job.event(parentDir, opts)
+			event.Duration = duration
+			sendWarning(event)
 		})
 	}
 
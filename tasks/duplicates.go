@@ -0,0 +1,478 @@
+package tasks
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"exputils/undolog"
+	"exputils/utils"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DuplicatesDir is the subfolder duplicates are moved to.
+const DuplicatesDir = "_duplicates"
+
+type DuplicateFile struct {
+	Name          string
+	Size          int64
+	Width, Height int
+}
+
+// DuplicateGroup is a set of files with the same content, or with images that
+// look the same. It's sent through sendWarning so the TUI can list it for
+// review.
+type DuplicateGroup struct {
+	// Exact is true for byte-identical files, false for look-alike images.
+	Exact bool
+	Files []DuplicateFile
+	// Keeper is the index of the file to keep when resolving the group.
+	Keeper int
+}
+
+func (g DuplicateGroup) Error() string {
+	names := []string{}
+	for _, f := range g.Files {
+		names = append(names, f.Name)
+	}
+	kind := "similar images"
+	if g.Exact {
+		kind = "identical files"
+	}
+	return fmt.Sprintf("%d %s: %s", len(g.Files), kind, strings.Join(names, ", "))
+}
+
+type DuplicatesOptions struct {
+	// Perceptual also groups images whose dHash differs by at most Threshold bits.
+	Perceptual bool
+	Threshold  int
+}
+
+func ParseDuplicatesOptions(o Options) (DuplicatesOptions, error) {
+	opts := DuplicatesOptions{Perceptual: true, Threshold: 6}
+	var err error
+	if opts.Perceptual, err = o.Bool("perceptual", opts.Perceptual); err != nil {
+		return opts, err
+	}
+	if opts.Threshold, err = o.Int("threshold", opts.Threshold); err != nil {
+		return opts, err
+	}
+	if opts.Threshold < 0 || opts.Threshold > 64 {
+		return opts, fmt.Errorf("option 'threshold' must be between 0 and 64")
+	}
+	return opts, nil
+}
+
+var imageExts = []string{".jpg", ".jpeg", ".png", ".gif"}
+
+// FindDuplicates groups byte-identical files, comparing sizes first and then
+// SHA-256 hashes, and optionally images that look the same.
+func FindDuplicates(
+	ctx context.Context,
+	parentDir string,
+	poolSize int,
+	opts DuplicatesOptions,
+	updateProgressBase func(func() float64) func(),
+	sendWarning func(error),
+) {
+	entries, err := os.ReadDir(parentDir)
+	if err != nil {
+		sendWarning(fmt.Errorf("can't read directory: %w", err))
+		return
+	}
+
+	files := map[string]*DuplicateFile{}
+	bySize := map[int64][]string{}
+	images := []string{}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			sendWarning(fmt.Errorf("can't stat '%s': %w", entry.Name(), err))
+			continue
+		}
+		files[entry.Name()] = &DuplicateFile{Name: entry.Name(), Size: info.Size()}
+		bySize[info.Size()] = append(bySize[info.Size()], entry.Name())
+		if opts.Perceptual && utils.Contains(imageExts, strings.ToLower(filepath.Ext(entry.Name()))) {
+			images = append(images, entry.Name())
+		}
+	}
+
+	toHash := []string{}
+	for _, names := range bySize {
+		if len(names) > 1 {
+			toHash = append(toHash, names...)
+		}
+	}
+	if len(toHash)+len(images) == 0 {
+		sendWarning(fmt.Errorf("no duplicates found"))
+		return
+	}
+
+	processedFiles := 0
+	var mutex sync.Mutex
+	updateProgress := updateProgressBase(func() float64 {
+		mutex.Lock()
+		defer mutex.Unlock()
+		processedFiles++
+		return float64(processedFiles) / float64(len(toHash)+len(images))
+	})
+
+	sums := map[string]string{}
+	hashes := map[string]uint64{}
+
+	pool := utils.NewWorkerPool(ctx, poolSize)
+
+	for _, fileName := range toHash {
+		pool.Run(func() {
+			defer updateProgress()
+			sum, err := sha256File(filepath.Join(parentDir, fileName))
+			if err != nil {
+				sendWarning(fmt.Errorf("can't hash '%s': %w", fileName, err))
+				return
+			}
+			mutex.Lock()
+			sums[fileName] = sum
+			mutex.Unlock()
+		})
+	}
+	for _, fileName := range images {
+		pool.Run(func() {
+			defer updateProgress()
+			hash, width, height, err := dHashFile(filepath.Join(parentDir, fileName))
+			if err != nil {
+				sendWarning(Event{File: fileName, Status: StatusSkipped, Message: fmt.Sprintf("can't decode: %s", err)})
+				return
+			}
+			mutex.Lock()
+			hashes[fileName] = hash
+			files[fileName].Width, files[fileName].Height = width, height
+			mutex.Unlock()
+		})
+	}
+
+	pool.WaitAndClose()
+
+	if ctx.Err() != nil {
+		sendWarning(ctx.Err())
+		return
+	}
+
+	groups := []DuplicateGroup{}
+	// representative is the keeper of the exact group of a file
+	representative := map[string]string{}
+
+	bySum := map[string][]string{}
+	for fileName, sum := range sums {
+		bySum[sum] = append(bySum[sum], fileName)
+	}
+	for _, names := range bySum {
+		if len(names) < 2 {
+			continue
+		}
+		sort.Strings(names)
+		group := DuplicateGroup{Exact: true}
+		for _, name := range names {
+			group.Files = append(group.Files, *files[name])
+		}
+		for _, name := range names {
+			representative[name] = group.Files[group.Keeper].Name
+		}
+		groups = append(groups, group)
+	}
+
+	for _, names := range clusterImages(hashes, opts.Threshold) {
+		// exact duplicates are already grouped, only their keeper stands for
+		// them here, and a cluster made of a single exact group is dropped
+		representatives := []string{}
+		for _, name := range names {
+			if keeper, ok := representative[name]; !ok || keeper == name {
+				representatives = append(representatives, name)
+			}
+		}
+		if len(representatives) < 2 {
+			continue
+		}
+
+		group := DuplicateGroup{}
+		for _, name := range representatives {
+			group.Files = append(group.Files, *files[name])
+		}
+		// keep the biggest image, then the biggest file
+		for i, f := range group.Files {
+			keeper := group.Files[group.Keeper]
+			if f.Width*f.Height > keeper.Width*keeper.Height ||
+				(f.Width*f.Height == keeper.Width*keeper.Height && f.Size > keeper.Size) {
+				group.Keeper = i
+			}
+		}
+		groups = append(groups, group)
+	}
+
+	if len(groups) == 0 {
+		sendWarning(fmt.Errorf("no duplicates found"))
+		return
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Files[0].Name < groups[j].Files[0].Name })
+	for _, group := range groups {
+		sendWarning(group)
+	}
+	updateProgressBase(func() float64 { return 1 })()
+}
+
+// SetKeeper picks the file to keep in a group. The similar groups list the
+// keeper of an exact group in its place, they follow the new one.
+func SetKeeper(groups []DuplicateGroup, g, f int) {
+	groups[g].Keeper = f
+	if !groups[g].Exact {
+		return
+	}
+	keeper := groups[g].Files[f]
+	for i := range groups {
+		if groups[i].Exact {
+			continue
+		}
+		for j, file := range groups[i].Files {
+			for _, member := range groups[g].Files {
+				if file.Name == member.Name {
+					groups[i].Files[j] = keeper
+				}
+			}
+		}
+	}
+}
+
+// ResolveDuplicates moves every file but the keeper of each group to the
+// duplicates subfolder, or to the trash. A file of a similar group stands for
+// its exact group: the whole exact group goes when it loses, only its keeper
+// stays when it wins.
+func ResolveDuplicates(
+	ctx context.Context,
+	parentDir string,
+	groups []DuplicateGroup,
+	toTrash bool,
+	updateProgressBase func(func() float64) func(),
+	sendWarning func(error),
+) {
+	exactOf := map[string]DuplicateGroup{}
+	for _, group := range groups {
+		if group.Exact {
+			for _, f := range group.Files {
+				exactOf[f.Name] = group
+			}
+		}
+	}
+
+	// the keepers of the similar groups win over those of the exact groups,
+	// and their files that lose take their exact group with them
+	keepers := map[string]bool{}
+	moved := map[string]bool{}
+	for _, group := range groups {
+		if group.Exact {
+			continue
+		}
+		for i, f := range group.Files {
+			if i == group.Keeper {
+				keepers[f.Name] = true
+				continue
+			}
+			moved[f.Name] = true
+			for _, member := range exactOf[f.Name].Files {
+				moved[member.Name] = true
+			}
+		}
+	}
+	for _, group := range groups {
+		if !group.Exact {
+			continue
+		}
+		keeper := group.Files[group.Keeper].Name
+		for _, f := range group.Files {
+			if keepers[f.Name] {
+				keeper = f.Name
+			}
+		}
+		for _, f := range group.Files {
+			if f.Name != keeper {
+				moved[f.Name] = true
+			}
+		}
+	}
+
+	toMove := []string{}
+	for _, group := range groups {
+		for _, f := range group.Files {
+			if moved[f.Name] && !keepers[f.Name] && !utils.Contains(toMove, f.Name) {
+				toMove = append(toMove, f.Name)
+			}
+		}
+	}
+	if len(toMove) == 0 {
+		return
+	}
+
+	duplicatesDir := filepath.Join(parentDir, DuplicatesDir)
+	if !toTrash {
+		if err := os.MkdirAll(duplicatesDir, 0o755); err != nil {
+			sendWarning(fmt.Errorf("can't create '%s': %w", duplicatesDir, err))
+			return
+		}
+	}
+
+	for i, fileName := range toMove {
+		if ctx.Err() != nil {
+			sendWarning(ctx.Err())
+			return
+		}
+
+		inputFile := filepath.Join(parentDir, fileName)
+		if toTrash {
+			if err := utils.MoveToTrash(inputFile); err != nil {
+				sendWarning(err)
+			} else {
+				sendWarning(Event{File: fileName, Status: StatusTrashed})
+				if err := undolog.FromContext(ctx).Trashed(inputFile); err != nil {
+					sendWarning(err)
+				}
+			}
+		} else {
+			outputFile := filepath.Join(duplicatesDir, fileName)
+			if _, err := os.Stat(outputFile); err == nil {
+				sendWarning(fmt.Errorf("'%s' already exists", outputFile))
+			} else if err := os.Rename(inputFile, outputFile); err != nil {
+				sendWarning(fmt.Errorf("can't move '%s': %w", fileName, err))
+			} else {
+				sendWarning(Event{File: fileName, Status: StatusMoved, Message: "moved to " + DuplicatesDir})
+				if err := undolog.FromContext(ctx).Moved(inputFile, outputFile); err != nil {
+					sendWarning(err)
+				}
+			}
+		}
+
+		progress := float64(i+1) / float64(len(toMove))
+		updateProgressBase(func() float64 { return progress })()
+	}
+}
+
+func sha256File(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// clusterImages links images whose hashes are at most threshold bits apart
+// and returns the groups of linked images.
+func clusterImages(hashes map[string]uint64, threshold int) [][]string {
+	names := make([]string, 0, len(hashes))
+	for name := range hashes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parent := make([]int, len(names))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := range names {
+		for j := i + 1; j < len(names); j++ {
+			if bits.OnesCount64(hashes[names[i]]^hashes[names[j]]) <= threshold {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	clusters := map[int][]string{}
+	for i, name := range names {
+		root := find(i)
+		clusters[root] = append(clusters[root], name)
+	}
+	result := [][]string{}
+	for _, cluster := range clusters {
+		if len(cluster) > 1 {
+			result = append(result, cluster)
+		}
+	}
+	return result
+}
+
+// dHashFile decodes an image and returns its difference hash: the image is
+// shrunk to 9x8 grey pixels and every bit tells whether a pixel is brighter
+// than its right neighbour.
+func dHashFile(path string) (uint64, int, int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	bounds := img.Bounds()
+	if bounds.Dx() == 0 || bounds.Dy() == 0 {
+		return 0, 0, 0, fmt.Errorf("empty image")
+	}
+
+	// average the source pixels falling in each cell, which is enough of a
+	// resize for hashing
+	var grey [8][9]float64
+	for y := 0; y < 8; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/8
+		y1 := max(bounds.Min.Y+(y+1)*bounds.Dy()/8, y0+1)
+		for x := 0; x < 9; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/9
+			x1 := max(bounds.Min.X+(x+1)*bounds.Dx()/9, x0+1)
+
+			sum, count := 0.0, 0
+			stepY, stepX := max((y1-y0)/16, 1), max((x1-x0)/16, 1)
+			for sy := y0; sy < y1; sy += stepY {
+				for sx := x0; sx < x1; sx += stepX {
+					r, g, b, _ := img.At(sx, sy).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+					count++
+				}
+			}
+			grey[y][x] = sum / float64(count)
+		}
+	}
+
+	hash := uint64(0)
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if grey[y][x] > grey[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash, bounds.Dx(), bounds.Dy(), nil
+}
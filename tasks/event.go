@@ -0,0 +1,84 @@
+package tasks
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusWarning Status = "warning"
+	StatusSkipped Status = "skipped"
+	StatusMoved   Status = "moved"
+	StatusTrashed Status = "moved to trash"
+	StatusPlanned Status = "planned"
+	StatusRenamed Status = "renamed"
+	StatusRemoved Status = "removed"
+
+	// outcomes of running a tool on a file
+	StatusConverted Status = "converted"
+	StatusCreated   Status = "created"
+	StatusFailed    Status = "failed"
+
+	// paths taken by a jxl decode
+	StatusReconstructed Status = "reconstructed"
+	StatusDecoded       Status = "decoded"
+
+	// results of comparing an output to its input
+	StatusCompared  Status = "compared"
+	StatusUnchanged Status = "barely changed"
+
+	// states of a PAR2 recovery set
+	StatusIntact        Status = "intact"
+	StatusRepairable    Status = "damaged but repairable"
+	StatusUnrecoverable Status = "unrecoverable"
+	StatusRepaired      Status = "repaired"
+	StatusProtected     Status = "protected"
+	StatusUnprotected   Status = "not protected"
+	StatusDamaged       Status = "damaged"
+
+	// states of a file checked against a checksum manifest
+	StatusMissing Status = "missing"
+	StatusChanged Status = "changed"
+	StatusExtra   Status = "extra"
+)
+
+// Event is a structured warning about a single file. It goes through
+// sendWarning like any other error, so consumers that only care about the
+// message don't need to know about it.
+type Event struct {
+	File string
+	// Output is the file produced from File, if any.
+	Output  string
+	Status  Status
+	Message string
+	// Duration is how long the file took, for tasks running a tool on it.
+	Duration time.Duration
+}
+
+// relativeOutput returns an output path relative to the folder, for
+// Event.Output.
+func relativeOutput(parentDir, outputFile string) string {
+	output, err := filepath.Rel(parentDir, outputFile)
+	if err != nil {
+		return outputFile
+	}
+	return output
+}
+
+func (e Event) Error() string {
+	subject := e.File
+	if e.Output != "" {
+		subject = fmt.Sprintf("%s -> %s", e.File, e.Output)
+	}
+	switch {
+	case subject == "":
+		return e.Message
+	case e.Message == "":
+		return fmt.Sprintf("%s: %s", subject, e.Status)
+	default:
+		return fmt.Sprintf("%s: %s", subject, e.Message)
+	}
+}
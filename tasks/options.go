@@ -0,0 +1,72 @@
+package tasks
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Options are the per-run settings of a task, keyed by option name.
+type Options map[string]string
+
+// String returns the option, or fallback if it's not set.
+func (o Options) String(key, fallback string) string {
+	if value, ok := o[key]; ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+// Int returns the option parsed as an integer, or fallback if it's not set.
+func (o Options) Int(key string, fallback int) (int, error) {
+	value, ok := o[key]
+	if !ok || value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return fallback, fmt.Errorf("option '%s' must be an integer, got '%s'", key, value)
+	}
+	return n, nil
+}
+
+// Bool returns the option parsed as a boolean, or fallback if it's not set.
+func (o Options) Bool(key string, fallback bool) (bool, error) {
+	value, ok := o[key]
+	if !ok || value == "" {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return fallback, fmt.Errorf("option '%s' must be true or false, got '%s'", key, value)
+	}
+	return b, nil
+}
+
+// List returns the option split on commas, or fallback if it's not set.
+func (o Options) List(key string, fallback []string) []string {
+	value, ok := o[key]
+	if !ok || value == "" {
+		return fallback
+	}
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// resolveOutputDir resolves an output directory option against the folder,
+// empty is the folder itself.
+func resolveOutputDir(parentDir, outputDir string) string {
+	switch {
+	case outputDir == "":
+		return parentDir
+	case filepath.IsAbs(outputDir):
+		return outputDir
+	}
+	return filepath.Join(parentDir, outputDir)
+}
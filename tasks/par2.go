@@ -2,6 +2,9 @@ package tasks
 
 import (
 	"context"
+	"exputils/par2"
+	"exputils/procs"
+	"exputils/undolog"
 	"exputils/utils"
 	"fmt"
 	"os"
@@ -9,76 +12,303 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 )
 
+type Par2Options struct {
+	// Tool is the name of the PAR2 backend, empty picks the first one found.
+	Tool string
+
+	// Redundancy is the size of the recovery data in percent of the input.
+	Redundancy int
+	// BlockSize and BlockCount are mutually exclusive, 0 lets the tool decide.
+	BlockSize  int
+	BlockCount int
+	// RecoveryFiles is the number of recovery volumes, 0 lets the tool decide.
+	RecoveryFiles int
+
+	// PerFile creates one recovery set per input file, otherwise a single set
+	// named after the folder protects all of them.
+	PerFile bool
+	// Globs select the input files.
+	Globs []string
+
+	// Verify verifies every recovery set right after creating it.
+	Verify bool
+}
+
+func DefaultPar2Options() Par2Options {
+	return Par2Options{
+		Redundancy: 11,
+		PerFile:    true,
+		Globs:      []string{"*.7z"},
+	}
+}
+
+// ParsePar2Options reads the Par2 task options, unset ones keep their default.
+func ParsePar2Options(o Options) (Par2Options, error) {
+	opts := DefaultPar2Options()
+	var err error
+
+	opts.Tool = o.String("tool", opts.Tool)
+	if opts.Redundancy, err = o.Int("redundancy", opts.Redundancy); err != nil {
+		return opts, err
+	}
+	if opts.BlockSize, err = o.Int("blockSize", opts.BlockSize); err != nil {
+		return opts, err
+	}
+	if opts.BlockCount, err = o.Int("blockCount", opts.BlockCount); err != nil {
+		return opts, err
+	}
+	if opts.RecoveryFiles, err = o.Int("recoveryFiles", opts.RecoveryFiles); err != nil {
+		return opts, err
+	}
+	if opts.Verify, err = o.Bool("verify", opts.Verify); err != nil {
+		return opts, err
+	}
+
+	switch mode := o.String("mode", "per-file"); mode {
+	case "per-file":
+		opts.PerFile = true
+	case "folder":
+		opts.PerFile = false
+	default:
+		return opts, fmt.Errorf("option 'mode' must be 'per-file' or 'folder', got '%s'", mode)
+	}
+
+	if opts.Globs, err = parseGlobs(o, opts.Globs); err != nil {
+		return opts, err
+	}
+
+	switch {
+	case opts.Redundancy < 0 || opts.Redundancy > 100:
+		return opts, fmt.Errorf("option 'redundancy' must be between 0 and 100")
+	case opts.BlockSize < 0 || opts.BlockCount < 0 || opts.RecoveryFiles < 0:
+		return opts, fmt.Errorf("options 'blockSize', 'blockCount' and 'recoveryFiles' can't be negative")
+	case opts.BlockSize > 0 && opts.BlockCount > 0:
+		return opts, fmt.Errorf("options 'blockSize' and 'blockCount' can't be used together")
+	case opts.BlockSize%4 != 0:
+		return opts, fmt.Errorf("option 'blockSize' must be a multiple of 4")
+	}
+	return opts, nil
+}
+
+// parseGlobs reads the "globs" option and checks every pattern is valid.
+func parseGlobs(o Options, fallback []string) ([]string, error) {
+	globs := o.List("globs", fallback)
+	for _, glob := range globs {
+		if _, err := filepath.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob '%s': %w", glob, err)
+		}
+	}
+	return globs, nil
+}
+
+// par2Job is a recovery set to create.
+type par2Job struct {
+	par2File   string
+	inputFiles []string
+}
+
+// Par2 creates recovery sets for the files matching the globs, either one per
+// file or one for the whole folder. Files that already have a set are skipped.
 func Par2(
 	ctx context.Context,
 	parentDir string,
 	poolSize int,
+	opts Par2Options,
 	updateProgressBase func(func() float64) func(),
 	sendWarning func(error),
 ) {
-	_7zFiles := []os.DirEntry{}
+	backend, err := findPar2Backend(opts.Tool)
+	if err != nil {
+		sendWarning(err)
+		return
+	}
+
 	entries, err := os.ReadDir(parentDir)
 	if err != nil {
 		sendWarning(fmt.Errorf("can't read directory: %w", err))
 		return
 	}
+	fileNames := []string{}
+	inputFiles := []string{}
 	for _, entry := range entries {
 		if entry.IsDir() {
 			continue
 		}
-		if strings.ToLower(filepath.Ext(entry.Name())) == ".7z" {
-			_7zFiles = append(_7zFiles, entry)
+		fileNames = append(fileNames, entry.Name())
+		if par2.IsPar2File(entry.Name()) {
+			continue
+		}
+		if matchGlobs(opts.Globs, entry.Name()) {
+			inputFiles = append(inputFiles, entry.Name())
+		}
+	}
+
+	if len(inputFiles) == 0 {
+		sendWarning(fmt.Errorf("no files matching %s found", strings.Join(opts.Globs, ", ")))
+		return
+	}
+
+	jobs := []par2Job{}
+	if opts.PerFile {
+		for _, fileName := range inputFiles {
+			if par2File, ok := findPar2Set(fileNames, fileName); ok {
+				sendWarning(describeExistingPar2Set(parentDir, par2File, fileName))
+				continue
+			}
+			jobs = append(jobs, par2Job{
+				par2File:   filepath.Join(parentDir, fileName+".par2"),
+				inputFiles: []string{filepath.Join(parentDir, fileName)},
+			})
+		}
+	} else {
+		setName := filepath.Base(parentDir)
+		if _, ok := findPar2Set(fileNames, setName); ok {
+			sendWarning(fmt.Errorf("recovery set '%s.par2' already exists", setName))
+			return
+		}
+		job := par2Job{par2File: filepath.Join(parentDir, setName+".par2")}
+		for _, fileName := range inputFiles {
+			job.inputFiles = append(job.inputFiles, filepath.Join(parentDir, fileName))
 		}
+		jobs = append(jobs, job)
 	}
 
-	if len(_7zFiles) == 0 {
-		sendWarning(fmt.Errorf("no 7z files found"))
+	if len(jobs) == 0 {
 		return
 	}
 
-	processedFiles := 0
+	steps := len(jobs)
+	if opts.Verify {
+		steps *= 2
+	}
+	processedSteps := 0
 	var progressMutex sync.Mutex
 	updateProgress := updateProgressBase(func() float64 {
 		progressMutex.Lock()
 		defer progressMutex.Unlock()
-		processedFiles++
-		return float64(processedFiles) / float64(len(_7zFiles))
+		processedSteps++
+		return float64(processedSteps) / float64(steps)
 	})
 
-	// remove all .par2 in the directory
-	if entries, err = os.ReadDir(parentDir); err != nil {
-		sendWarning(fmt.Errorf("can't read directory: %w", err))
-		return
-	} else {
-		for _, entry := range entries {
-			if entry.IsDir() {
-				continue
-			}
-			if strings.ToLower(filepath.Ext(entry.Name())) == ".par2" {
-				sendWarning(fmt.Errorf("there are .par2 files in the directory"))
-				return
-			}
-		}
-	}
-
 	pool := utils.NewWorkerPool(ctx, poolSize)
 
-	for _, file := range _7zFiles {
-		input7zFile := filepath.Join(parentDir, file.Name())
+	for _, job := range jobs {
 		pool.Run(func() {
 			defer updateProgress()
+			if opts.Verify {
+				defer updateProgress()
+			}
+			par2FileName := filepath.Base(job.par2File)
+			started := time.Now()
 
-			cmd := exec.CommandContext(ctx, "par2j64.exe", "c", "/rr11", input7zFile+".par2", input7zFile)
-			outputMsgBytes, err := cmd.CombinedOutput()
+			cmd := exec.CommandContext(ctx, backend.executable, backend.createArgs(job.par2File, opts, job.inputFiles)...)
+			cmd.Dir = parentDir
+			outputMsgBytes, err := procs.CombinedOutput(ctx, cmd)
 			outputMsgString := string(outputMsgBytes)
+			event := Event{File: par2FileName, Status: StatusFailed}
+			if opts.PerFile {
+				event = Event{File: filepath.Base(job.inputFiles[0]), Output: par2FileName, Status: StatusFailed}
+			}
 			switch {
 			case err != nil && outputMsgString != "":
-				sendWarning(fmt.Errorf("par2 error: %s", outputMsgString))
+				event.Message = fmt.Sprintf("%s error: %s", backend.name, outputMsgString)
 			case err != nil && outputMsgString == "":
-				sendWarning(fmt.Errorf("par2 error: %w", err))
+				event.Message = fmt.Sprintf("%s error: %s", backend.name, err)
+			}
+			event.Duration = time.Since(started)
+			if err != nil {
+				// a cancelled tool may have written some of the volumes
+				if err := recordPar2Set(ctx, job.par2File, fileNames); err != nil {
+					sendWarning(err)
+				}
+				sendWarning(event)
+				return
+			}
+			if err := recordPar2Set(ctx, job.par2File, fileNames); err != nil {
+				sendWarning(err)
 			}
+
+			event.Status = StatusCreated
+			if opts.Verify {
+				status, _, err := backend.verify(ctx, job.par2File, false)
+				if err != nil {
+					// the set was created, its row stays in the report
+					status = StatusWarning
+					event.Message = fmt.Sprintf("created but can't verify: %s", err)
+				}
+				event.Status = status
+			}
+			sendWarning(event)
 		})
 	}
+
+	pool.WaitAndClose()
+	updateProgressBase(func() float64 { return 1 })()
+}
+
+// findPar2Set returns a .par2 file of the recovery set with the given name.
+func findPar2Set(fileNames []string, setName string) (string, bool) {
+	for _, par2File := range par2.FindSets(fileNames) {
+		if strings.EqualFold(par2.SetName(par2File), setName) {
+			return par2File, true
+		}
+	}
+	return "", false
+}
+
+// recordPar2Set adds the files of a new recovery set to the undo log, the
+// tool picks the names of the volumes so they're found by set name.
+func recordPar2Set(ctx context.Context, par2File string, existing []string) error {
+	entries, err := os.ReadDir(filepath.Dir(par2File))
+	if err != nil {
+		return fmt.Errorf("can't list the files of '%s': %w", filepath.Base(par2File), err)
+	}
+	setName := par2.SetName(filepath.Base(par2File))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !par2.IsPar2File(name) || !strings.EqualFold(par2.SetName(name), setName) || utils.Contains(existing, name) {
+			continue
+		}
+		if err := undolog.FromContext(ctx).Created(filepath.Join(filepath.Dir(par2File), name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// describeExistingPar2Set tells why a file with a recovery set is skipped,
+// without running the PAR2 tool.
+func describeExistingPar2Set(parentDir, par2File, fileName string) Event {
+	set, err := par2.OpenSet(filepath.Join(parentDir, par2File))
+	switch {
+	case err != nil:
+		return Event{File: fileName, Status: StatusSkipped, Message: fmt.Sprintf("has an unreadable recovery set: %s", err)}
+	case !set.Protects(fileName):
+		return Event{File: fileName, Status: StatusSkipped, Message: fmt.Sprintf("'%s' exists but doesn't protect it", par2File)}
+	}
+	return Event{
+		File:    fileName,
+		Status:  StatusSkipped,
+		Message: fmt.Sprintf("already protected at %.1f%%", set.Redundancy()),
+	}
+}
+
+// EstimatePar2 estimates the size of the recovery files from the redundancy,
+// plus a few percent of packet headers and index files.
+func EstimatePar2(parentDir string, opts Par2Options) (SizeEstimate, error) {
+	inputFiles, err := listMatchingFiles(parentDir, opts.Globs)
+	if err != nil {
+		return SizeEstimate{}, err
+	}
+	e := sizeEstimator{targetDir: parentDir}
+	for _, inputFile := range inputFiles {
+		if par2.IsPar2File(inputFile) {
+			continue
+		}
+		e.files = append(e.files, fileEstimate{inputFile, fileSize(inputFile) * int64(opts.Redundancy) * 105 / 10000})
+	}
+	return e.estimate(context.Background(), 0)
 }
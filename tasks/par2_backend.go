@@ -0,0 +1,158 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"exputils/procs"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// par2Backend is one of the supported PAR2 command line tools.
+type par2Backend struct {
+	name       string
+	executable string
+
+	createArgs func(par2File string, opts Par2Options, inputFiles []string) []string
+	verifyArgs func(par2File string) []string
+	repairArgs func(par2File string) []string
+
+	// verifyStatus maps the exit code of a verify or repair run to the
+	// state of the recovery set, false if the code means the tool failed.
+	verifyStatus func(exitCode int, repair bool) (Status, bool)
+}
+
+var par2Backends = []par2Backend{
+	{
+		name:       "par2j",
+		executable: "par2j64.exe",
+		createArgs: func(par2File string, opts Par2Options, inputFiles []string) []string {
+			args := []string{"c", fmt.Sprintf("/rr%d", opts.Redundancy)}
+			if opts.BlockSize > 0 {
+				args = append(args, fmt.Sprintf("/ss%d", opts.BlockSize))
+			}
+			if opts.BlockCount > 0 {
+				args = append(args, fmt.Sprintf("/sn%d", opts.BlockCount))
+			}
+			if opts.RecoveryFiles > 0 {
+				args = append(args, fmt.Sprintf("/rn%d", opts.RecoveryFiles))
+			}
+			return append(append(args, par2File), inputFiles...)
+		},
+		verifyArgs: func(par2File string) []string { return []string{"v", par2File} },
+		repairArgs: func(par2File string) []string { return []string{"r", par2File} },
+		// return codes as documented by MultiPar
+		verifyStatus: func(exitCode int, repair bool) (Status, bool) {
+			switch {
+			case exitCode == 0 && repair:
+				return StatusRepaired, true
+			case exitCode == 0:
+				return StatusIntact, true
+			case exitCode == 16:
+				return StatusRepairable, true
+			case exitCode == 17:
+				return StatusUnrecoverable, true
+			}
+			return "", false
+		},
+	},
+	{
+		name:       "par2cmdline",
+		executable: "par2",
+		createArgs: func(par2File string, opts Par2Options, inputFiles []string) []string {
+			args := []string{"create", fmt.Sprintf("-r%d", opts.Redundancy)}
+			if opts.BlockSize > 0 {
+				args = append(args, fmt.Sprintf("-s%d", opts.BlockSize))
+			}
+			if opts.BlockCount > 0 {
+				args = append(args, fmt.Sprintf("-b%d", opts.BlockCount))
+			}
+			if opts.RecoveryFiles > 0 {
+				args = append(args, fmt.Sprintf("-n%d", opts.RecoveryFiles))
+			}
+			return append(append(args, "--", par2File), inputFiles...)
+		},
+		verifyArgs: func(par2File string) []string { return []string{"verify", par2File} },
+		repairArgs: func(par2File string) []string { return []string{"repair", par2File} },
+		// eSuccess, eRepairPossible, eRepairNotPossible from par2cmdline
+		verifyStatus: func(exitCode int, repair bool) (Status, bool) {
+			switch {
+			case exitCode == 0 && repair:
+				return StatusRepaired, true
+			case exitCode == 0:
+				return StatusIntact, true
+			case exitCode == 1:
+				return StatusRepairable, true
+			case exitCode == 2:
+				return StatusUnrecoverable, true
+			}
+			return "", false
+		},
+	},
+}
+
+// findPar2Backend returns the first supported PAR2 tool found in PATH, or
+// the one with the given name if it's not empty.
+func findPar2Backend(name string) (par2Backend, error) {
+	for _, backend := range par2Backends {
+		if name != "" && name != backend.name {
+			continue
+		}
+		if _, err := exec.LookPath(backend.executable); err == nil {
+			return backend, nil
+		} else if name != "" {
+			return par2Backend{}, fmt.Errorf("%s not found in PATH", backend.executable)
+		}
+	}
+	if name != "" {
+		return par2Backend{}, fmt.Errorf("unknown par2 tool '%s'", name)
+	}
+
+	names := []string{}
+	for _, backend := range par2Backends {
+		names = append(names, backend.executable)
+	}
+	return par2Backend{}, fmt.Errorf("no par2 tool found in PATH, install one of %s", strings.Join(names, ", "))
+}
+
+// verify runs verification of a recovery set and reports its state. With
+// repair set, a set verification finds repairable is then repaired, the other
+// ones are reported as verified.
+func (b par2Backend) verify(ctx context.Context, par2File string, repair bool) (Status, string, error) {
+	status, output, err := b.run(ctx, par2File, false)
+	if err != nil || !repair || status != StatusRepairable {
+		return status, output, err
+	}
+	return b.run(ctx, par2File, true)
+}
+
+// run runs the verify or repair command once.
+func (b par2Backend) run(ctx context.Context, par2File string, repair bool) (Status, string, error) {
+	args := b.verifyArgs(par2File)
+	if repair {
+		args = b.repairArgs(par2File)
+	}
+	cmd := exec.CommandContext(ctx, b.executable, args...)
+	cmd.Dir = filepath.Dir(par2File)
+	outputMsgBytes, err := procs.CombinedOutput(ctx, cmd)
+	outputMsgString := string(outputMsgBytes)
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		status, _ := b.verifyStatus(0, repair)
+		return status, outputMsgString, nil
+	case errors.As(err, &exitErr):
+		if status, ok := b.verifyStatus(exitErr.ExitCode(), repair); ok {
+			return status, outputMsgString, nil
+		}
+		if outputMsgString != "" {
+			return "", outputMsgString, fmt.Errorf("%s error: %s", b.name, outputMsgString)
+		}
+		return "", "", fmt.Errorf("%s error: %w", b.name, err)
+	default:
+		return "", "", fmt.Errorf("%s error: %w", b.name, err)
+	}
+}
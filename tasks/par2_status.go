@@ -0,0 +1,94 @@
+package tasks
+
+import (
+	"context"
+	"exputils/par2"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Par2Status reports which files matching the globs are protected by a
+// recovery set in the directory, and at what redundancy. It reads the .par2
+// files itself and doesn't need a PAR2 tool.
+func Par2Status(
+	ctx context.Context,
+	parentDir string,
+	globs []string,
+	updateProgressBase func(func() float64) func(),
+	sendWarning func(error),
+) {
+	entries, err := os.ReadDir(parentDir)
+	if err != nil {
+		sendWarning(fmt.Errorf("can't read directory: %w", err))
+		return
+	}
+	fileNames := []string{}
+	inputFiles := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		fileNames = append(fileNames, entry.Name())
+		if !par2.IsPar2File(entry.Name()) && matchGlobs(globs, entry.Name()) {
+			inputFiles = append(inputFiles, entry.Name())
+		}
+	}
+
+	if len(inputFiles) == 0 {
+		sendWarning(fmt.Errorf("no files matching %s found", strings.Join(globs, ", ")))
+		return
+	}
+
+	type protection struct {
+		par2File string
+		set      *par2.Set
+		file     par2.File
+	}
+	protections := map[string]protection{}
+	for _, par2File := range par2.FindSets(fileNames) {
+		set, err := par2.OpenSet(filepath.Join(parentDir, par2File))
+		if err != nil {
+			sendWarning(Event{File: par2File, Status: StatusWarning, Message: err.Error()})
+			continue
+		}
+		for _, f := range set.Files {
+			if f.Name != "" {
+				protections[strings.ToLower(f.Name)] = protection{par2File, set, f}
+			}
+		}
+	}
+
+	for i, fileName := range inputFiles {
+		if ctx.Err() != nil {
+			sendWarning(ctx.Err())
+			return
+		}
+
+		p, ok := protections[strings.ToLower(fileName)]
+		if !ok {
+			sendWarning(Event{File: fileName, Status: StatusUnprotected})
+		} else if state, err := par2.QuickCheck(parentDir, p.file); err != nil {
+			sendWarning(Event{File: fileName, Status: StatusWarning, Message: err.Error()})
+		} else if state != par2.FileOK {
+			sendWarning(Event{
+				File:    fileName,
+				Status:  StatusDamaged,
+				Message: fmt.Sprintf("%s according to '%s'", state, p.par2File),
+			})
+		} else {
+			sendWarning(Event{
+				File:   fileName,
+				Status: StatusProtected,
+				Message: fmt.Sprintf(
+					"protected at %.1f%% by '%s' (%d recovery blocks of %d KiB)",
+					p.set.Redundancy(), p.par2File, p.set.RecoveryBlocks, p.set.BlockSize/1024,
+				),
+			})
+		}
+
+		progress := float64(i+1) / float64(len(inputFiles))
+		updateProgressBase(func() float64 { return progress })()
+	}
+}
@@ -0,0 +1,75 @@
+package tasks
+
+import (
+	"context"
+	"exputils/par2"
+	"exputils/utils"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Par2Verify verifies every recovery set in the directory and reports its
+// state, with repair it also repairs the damaged ones.
+func Par2Verify(
+	ctx context.Context,
+	parentDir string,
+	poolSize int,
+	tool string,
+	repair bool,
+	updateProgressBase func(func() float64) func(),
+	sendWarning func(error),
+) {
+	backend, err := findPar2Backend(tool)
+	if err != nil {
+		sendWarning(err)
+		return
+	}
+
+	entries, err := os.ReadDir(parentDir)
+	if err != nil {
+		sendWarning(fmt.Errorf("can't read directory: %w", err))
+		return
+	}
+	fileNames := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			fileNames = append(fileNames, entry.Name())
+		}
+	}
+
+	par2Files := par2.FindSets(fileNames)
+	if len(par2Files) == 0 {
+		sendWarning(fmt.Errorf("no par2 files found"))
+		return
+	}
+
+	processedFiles := 0
+	var progressMutex sync.Mutex
+	updateProgress := updateProgressBase(func() float64 {
+		progressMutex.Lock()
+		defer progressMutex.Unlock()
+		processedFiles++
+		return float64(processedFiles) / float64(len(par2Files))
+	})
+
+	pool := utils.NewWorkerPool(ctx, poolSize)
+
+	for _, fileName := range par2Files {
+		par2File := filepath.Join(parentDir, fileName)
+		pool.Run(func() {
+			defer updateProgress()
+
+			status, _, err := backend.verify(ctx, par2File, repair)
+			if err != nil {
+				sendWarning(fmt.Errorf("%s: %w", fileName, err))
+				return
+			}
+			sendWarning(Event{File: fileName, Status: status})
+		})
+	}
+
+	pool.WaitAndClose()
+	updateProgressBase(func() float64 { return 1 })()
+}
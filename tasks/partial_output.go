@@ -0,0 +1,32 @@
+package tasks
+
+import (
+	"context"
+	"exputils/undolog"
+	"os"
+)
+
+// partialOutput is the output file of a tool, a failed or cancelled tool may
+// leave part of it behind.
+type partialOutput struct {
+	path    string
+	existed bool
+}
+
+// watchOutput remembers whether the output file exists before the tool runs.
+func watchOutput(path string) partialOutput {
+	_, err := os.Lstat(path)
+	return partialOutput{path: path, existed: err == nil}
+}
+
+// record adds what the tool left behind to the undo log, so undoing the run
+// removes it. A file that was there before isn't the tool's.
+func (p partialOutput) record(ctx context.Context) error {
+	if p.existed {
+		return nil
+	}
+	if _, err := os.Stat(p.path); err != nil {
+		return nil
+	}
+	return undolog.FromContext(ctx).Created(p.path)
+}
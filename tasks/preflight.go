@@ -0,0 +1,183 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"exputils/utils"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// SizeEstimate is how much a run is expected to write, and where.
+type SizeEstimate struct {
+	TargetDir string
+	Bytes     int64
+	// Sampled is the number of files converted for real to correct the
+	// heuristic, 0 when the estimate is the heuristic alone.
+	Sampled int
+}
+
+// fileEstimate is the heuristic output size of one input file.
+type fileEstimate struct {
+	inputFile string
+	bytes     int64
+}
+
+// sizeEstimator estimates the output of a run from per-file heuristics. If
+// convert is set, a sample of the files can be converted to a temporary
+// directory and the heuristic scaled by how far off it was on them.
+type sizeEstimator struct {
+	targetDir string
+	files     []fileEstimate
+	convert   func(ctx context.Context, inputFile, outputDir string) (string, error)
+}
+
+func (e sizeEstimator) estimate(ctx context.Context, sample int) (SizeEstimate, error) {
+	result := SizeEstimate{TargetDir: e.targetDir}
+	for _, f := range e.files {
+		result.Bytes += f.bytes
+	}
+	if sample <= 0 || e.convert == nil || len(e.files) == 0 || result.Bytes == 0 {
+		return result, nil
+	}
+
+	tmpDir, err := os.MkdirTemp("", "exputils-trial-")
+	if err != nil {
+		return result, fmt.Errorf("can't create trial directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// files spread over the folder, in name order
+	files := append([]fileEstimate{}, e.files...)
+	sort.Slice(files, func(i, j int) bool { return files[i].inputFile < files[j].inputFile })
+	sample = min(sample, len(files))
+	estimated, actual := int64(0), int64(0)
+	for i := 0; i < sample; i++ {
+		f := files[i*len(files)/sample]
+		outputFile, err := e.convert(ctx, f.inputFile, tmpDir)
+		if err != nil {
+			return result, fmt.Errorf("trial conversion of '%s' failed: %w", filepath.Base(f.inputFile), err)
+		}
+		info, err := os.Stat(outputFile)
+		if err != nil {
+			return result, fmt.Errorf("trial conversion of '%s' failed: %w", filepath.Base(f.inputFile), err)
+		}
+		os.Remove(outputFile)
+		estimated += f.bytes
+		actual += info.Size()
+	}
+	if estimated > 0 {
+		result.Bytes = int64(float64(result.Bytes) * float64(actual) / float64(estimated))
+	}
+	result.Sampled = sample
+	return result, nil
+}
+
+// listMatchingFiles returns the files of the folder matching the globs.
+func listMatchingFiles(parentDir string, globs []string) ([]string, error) {
+	entries, err := os.ReadDir(parentDir)
+	if err != nil {
+		return nil, fmt.Errorf("can't read directory: %w", err)
+	}
+	files := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && matchGlobs(globs, entry.Name()) {
+			files = append(files, filepath.Join(parentDir, entry.Name()))
+		}
+	}
+	if len(files) == 0 {
+		return nil, errNoEstimate
+	}
+	return files, nil
+}
+
+// fileSize returns the size of a file, 0 if it can't be read.
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// existingParent returns the closest existing directory of path, the target
+// directory of a run may not be created yet.
+func existingParent(path string) string {
+	for {
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
+
+// spaceMargin is the share of the free space a run may fill before the
+// preflight warns.
+const spaceMargin = 0.9
+
+// CheckDiskSpace estimates the output of the task and compares it to the free
+// space of the target directory. It returns false when the run should not
+// start. The "spaceCheck" option picks whether a run that doesn't fit is
+// refused ("refuse", the default), only warned about ("warn") or not checked
+// ("off"), "trialSample" is the number of files converted to correct the
+// estimate.
+func CheckDiskSpace(ctx context.Context, task Task, parentDir string, opts Options, sendWarning func(error)) bool {
+	if task.Estimate == nil {
+		return true
+	}
+	mode := opts.String("spaceCheck", "refuse")
+	switch mode {
+	case "off":
+		return true
+	case "refuse", "warn":
+	default:
+		sendWarning(fmt.Errorf("option 'spaceCheck' must be 'refuse', 'warn' or 'off', got '%s'", mode))
+		return false
+	}
+	sample, err := opts.Int("trialSample", 0)
+	if err != nil {
+		sendWarning(err)
+		return false
+	}
+
+	estimate, err := task.Estimate(ctx, parentDir, opts, sample)
+	if err != nil {
+		// the task reports bad options and missing inputs itself
+		if !errors.Is(err, errNoEstimate) {
+			sendWarning(fmt.Errorf("can't estimate output size: %w", err))
+		}
+		return true
+	}
+	free, err := utils.FreeSpace(existingParent(estimate.TargetDir))
+	if err != nil {
+		sendWarning(err)
+		return true
+	}
+
+	how := "estimated"
+	if estimate.Sampled > 0 {
+		how = fmt.Sprintf("estimated from %d trial conversions", estimate.Sampled)
+	}
+	message := fmt.Sprintf(
+		"needs about %s (%s), %s free on the target drive",
+		utils.FormatBytes(estimate.Bytes), how, utils.FormatBytes(int64(free)),
+	)
+	switch {
+	case estimate.Bytes > int64(free) && mode == "refuse":
+		sendWarning(fmt.Errorf("not started, %s", message))
+		return false
+	case float64(estimate.Bytes) > float64(free)*spaceMargin:
+		sendWarning(Event{Status: StatusWarning, Message: "low disk space, " + message})
+	}
+	return true
+}
+
+// errNoEstimate is returned by estimators when the task will refuse to run
+// anyway, like when there are no input files.
+var errNoEstimate = errors.New("nothing to estimate")
@@ -0,0 +1,31 @@
+package tasks
+
+import (
+	"context"
+	"exputils/procs"
+	"fmt"
+)
+
+// ApplyProcessOptions applies the options every task running external tools
+// understands, the returned context carries them. "priority" ("normal" or
+// "background") runs the tools of the run at that priority whatever the
+// toggle, unset follows the toggle. "memoryLimitMB" caps the memory of each
+// tool.
+func ApplyProcessOptions(ctx context.Context, o Options) (context.Context, error) {
+	if value := o.String("priority", ""); value != "" {
+		priority, err := procs.ParsePriority(value)
+		if err != nil {
+			return ctx, fmt.Errorf("option 'priority': %w", err)
+		}
+		ctx = procs.WithPriority(ctx, priority)
+	}
+
+	memoryLimit, err := o.Int("memoryLimitMB", 0)
+	if err != nil {
+		return ctx, err
+	}
+	if memoryLimit < 0 {
+		return ctx, fmt.Errorf("option 'memoryLimitMB' can't be negative")
+	}
+	return procs.NewContext(ctx, procs.Limits{MemoryBytes: uint64(memoryLimit) << 20}), nil
+}
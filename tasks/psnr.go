@@ -0,0 +1,60 @@
+package tasks
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"os"
+)
+
+func decodeImageFile(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	return img, err
+}
+
+// psnrFiles decodes both images and returns their peak signal-to-noise ratio
+// over the 8-bit RGB channels, +Inf for identical pixels.
+func psnrFiles(pathA, pathB string) (float64, error) {
+	a, err := decodeImageFile(pathA)
+	if err != nil {
+		return 0, err
+	}
+	b, err := decodeImageFile(pathB)
+	if err != nil {
+		return 0, err
+	}
+
+	boundsA, boundsB := a.Bounds(), b.Bounds()
+	if boundsA.Dx() != boundsB.Dx() || boundsA.Dy() != boundsB.Dy() {
+		return 0, fmt.Errorf("sizes differ, %dx%d and %dx%d", boundsA.Dx(), boundsA.Dy(), boundsB.Dx(), boundsB.Dy())
+	}
+	if boundsA.Empty() {
+		return 0, fmt.Errorf("empty image")
+	}
+
+	sum := 0.0
+	for y := 0; y < boundsA.Dy(); y++ {
+		for x := 0; x < boundsA.Dx(); x++ {
+			r1, g1, b1, _ := a.At(boundsA.Min.X+x, boundsA.Min.Y+y).RGBA()
+			r2, g2, b2, _ := b.At(boundsB.Min.X+x, boundsB.Min.Y+y).RGBA()
+			for _, d := range [3]float64{
+				float64(r1>>8) - float64(r2>>8),
+				float64(g1>>8) - float64(g2>>8),
+				float64(b1>>8) - float64(b2>>8),
+			} {
+				sum += d * d
+			}
+		}
+	}
+	mse := sum / float64(boundsA.Dx()*boundsA.Dy()*3)
+	if mse == 0 {
+		return math.Inf(1), nil
+	}
+	return 10 * math.Log10(255*255/mse), nil
+}
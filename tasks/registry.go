@@ -0,0 +1,344 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Task is an entry of the task registry, every entry gets a button in the TUI.
+type Task struct {
+	ID    string
+	Label string
+
+	// Confirm, if set, is the question the TUI asks before running the task.
+	Confirm string
+
+	// Choices are the answers to Confirm besides yes and no.
+	Choices []Choice
+
+	// OptionsOf is the ID of the task whose options this one uses, so a
+	// preview and the task it previews can't disagree. Empty means ID.
+	OptionsOf string
+
+	// Profile holds the options of a profile, they override the options of
+	// the task it was made from, see WithProfile.
+	Profile Options
+
+	// Estimate, if set, estimates the size of the output so the run can be
+	// refused when it wouldn't fit, see CheckDiskSpace.
+	Estimate func(ctx context.Context, parentDir string, opts Options, sample int) (SizeEstimate, error)
+
+	// Match lists the glob patterns of the files the task works on, the task
+	// is skipped if none of them matches a file in the folder. Empty means
+	// the task checks its inputs itself.
+	Match []string
+
+	Run func(
+		ctx context.Context,
+		parentDir string,
+		opts Options,
+		updateProgressBase func(func() float64) func(),
+		sendWarning func(error),
+	)
+}
+
+// Choice is another answer to the question of a task, it runs the task with
+// its options on top of the configured ones.
+type Choice struct {
+	Key     string
+	Label   string
+	Options Options
+}
+
+var (
+	registryMutex sync.Mutex
+	registry      = []Task{
+		{
+			ID:    "artefact",
+			Label: "Artefact",
+			Run: func(ctx context.Context, parentDir string, o Options, updateProgressBase func(func() float64) func(), sendWarning func(error)) {
+				opts, err := ParseArtefactOptions(o)
+				if err != nil {
+					sendWarning(err)
+					return
+				}
+				Artefact(ctx, parentDir, 3, opts, updateProgressBase, sendWarning)
+			},
+			Estimate: func(ctx context.Context, parentDir string, o Options, sample int) (SizeEstimate, error) {
+				opts, err := ParseArtefactOptions(o)
+				if err != nil {
+					return SizeEstimate{}, errNoEstimate
+				}
+				return EstimateArtefact(ctx, parentDir, opts, sample)
+			},
+		},
+		{
+			ID:    "par2",
+			Label: "PAR2",
+			Run: func(ctx context.Context, parentDir string, o Options, updateProgressBase func(func() float64) func(), sendWarning func(error)) {
+				opts, err := ParsePar2Options(o)
+				if err != nil {
+					sendWarning(err)
+					return
+				}
+				Par2(ctx, parentDir, 2, opts, updateProgressBase, sendWarning)
+			},
+			Estimate: func(_ context.Context, parentDir string, o Options, _ int) (SizeEstimate, error) {
+				opts, err := ParsePar2Options(o)
+				if err != nil {
+					return SizeEstimate{}, errNoEstimate
+				}
+				return EstimatePar2(parentDir, opts)
+			},
+		},
+		{
+			ID:    "par2-verify",
+			Label: "PAR2 Verify",
+			Match: []string{"*.par2"},
+			Run: func(ctx context.Context, parentDir string, o Options, updateProgressBase func(func() float64) func(), sendWarning func(error)) {
+				Par2Verify(ctx, parentDir, 2, o.String("tool", ""), false, updateProgressBase, sendWarning)
+			},
+		},
+		{
+			ID:      "par2-repair",
+			Label:   "PAR2 Repair",
+			Confirm: "Repair damaged files in place?",
+			Match:   []string{"*.par2"},
+			Run: func(ctx context.Context, parentDir string, o Options, updateProgressBase func(func() float64) func(), sendWarning func(error)) {
+				Par2Verify(ctx, parentDir, 2, o.String("tool", ""), true, updateProgressBase, sendWarning)
+			},
+		},
+		{
+			ID:    "par2-status",
+			Label: "PAR2 Status",
+			Run: func(ctx context.Context, parentDir string, o Options, updateProgressBase func(func() float64) func(), sendWarning func(error)) {
+				globs, err := parseGlobs(o, DefaultPar2Options().Globs)
+				if err != nil {
+					sendWarning(err)
+					return
+				}
+				Par2Status(ctx, parentDir, globs, updateProgressBase, sendWarning)
+			},
+		},
+		{
+			ID:    "checksum",
+			Label: "Checksums",
+			Run: func(ctx context.Context, parentDir string, o Options, updateProgressBase func(func() float64) func(), sendWarning func(error)) {
+				Checksum(ctx, parentDir, 2, o.String("algorithm", "sha256"), updateProgressBase, sendWarning)
+			},
+		},
+		{
+			ID:    "checksum-verify",
+			Label: "Verify Sums",
+			Run: func(ctx context.Context, parentDir string, o Options, updateProgressBase func(func() float64) func(), sendWarning func(error)) {
+				ChecksumVerify(ctx, parentDir, 2, o.String("manifest", ""), updateProgressBase, sendWarning)
+			},
+		},
+		{
+			ID:    "duplicates",
+			Label: "Duplicates",
+			Run: func(ctx context.Context, parentDir string, o Options, updateProgressBase func(func() float64) func(), sendWarning func(error)) {
+				opts, err := ParseDuplicatesOptions(o)
+				if err != nil {
+					sendWarning(err)
+					return
+				}
+				FindDuplicates(ctx, parentDir, 4, opts, updateProgressBase, sendWarning)
+			},
+		},
+		{
+			ID:        "rename-preview",
+			Label:     "Rename Preview",
+			OptionsOf: "rename",
+			Run: func(ctx context.Context, parentDir string, o Options, updateProgressBase func(func() float64) func(), sendWarning func(error)) {
+				opts, err := ParseRenameOptions(o)
+				if err != nil {
+					sendWarning(err)
+					return
+				}
+				RenamePreview(ctx, parentDir, opts, updateProgressBase, sendWarning)
+			},
+		},
+		{
+			ID:      "rename",
+			Label:   "Rename",
+			Confirm: "Rename the files as previewed?",
+			Run: func(ctx context.Context, parentDir string, o Options, updateProgressBase func(func() float64) func(), sendWarning func(error)) {
+				opts, err := ParseRenameOptions(o)
+				if err != nil {
+					sendWarning(err)
+					return
+				}
+				Rename(ctx, parentDir, opts, updateProgressBase, sendWarning)
+			},
+		},
+		{
+			ID:      "rename-undo",
+			Label:   "Undo Rename",
+			Confirm: "Revert the last rename in this folder?",
+			Run: func(ctx context.Context, parentDir string, _ Options, updateProgressBase func(func() float64) func(), sendWarning func(error)) {
+				UndoRename(ctx, parentDir, updateProgressBase, sendWarning)
+			},
+		},
+		{
+			ID:      "undo-last-run",
+			Label:   "Undo Last Run",
+			Confirm: "Revert the file changes of the last run?",
+			Choices: []Choice{
+				{Key: "f", Label: "force modified files", Options: Options{"mode": string(UndoForce)}},
+				{Key: "s", Label: "skip the run", Options: Options{"mode": string(UndoSkip)}},
+			},
+			Run: func(ctx context.Context, _ string, o Options, updateProgressBase func(func() float64) func(), sendWarning func(error)) {
+				mode, err := ParseUndoMode(o)
+				if err != nil {
+					sendWarning(err)
+					return
+				}
+				UndoLastRun(ctx, mode, updateProgressBase, sendWarning)
+			},
+		},
+		{
+			ID:    "start-task",
+			Label: "Demo Task",
+			Run: func(ctx context.Context, _ string, _ Options, updateProgressBase func(func() float64) func(), sendWarning func(error)) {
+				ExampleTask(ctx, updateProgressBase, sendWarning)
+			},
+		},
+		{
+			ID:    "jxl",
+			Label: "Lossless JXL",
+			Run: func(ctx context.Context, parentDir string, _ Options, updateProgressBase func(func() float64) func(), sendWarning func(error)) {
+				Cjxl(ctx, parentDir, 2, false, updateProgressBase, sendWarning)
+			},
+			Estimate: func(_ context.Context, parentDir string, _ Options, _ int) (SizeEstimate, error) {
+				return EstimateCjxl(parentDir, false)
+			},
+		},
+		{
+			ID:    "lossy-jxl",
+			Label: "Lossy JXL",
+			Run: func(ctx context.Context, parentDir string, _ Options, updateProgressBase func(func() float64) func(), sendWarning func(error)) {
+				Cjxl(ctx, parentDir, 2, true, updateProgressBase, sendWarning)
+			},
+			Estimate: func(_ context.Context, parentDir string, _ Options, _ int) (SizeEstimate, error) {
+				return EstimateCjxl(parentDir, true)
+			},
+		},
+		{
+			ID:    "djxl",
+			Label: "DJXL",
+			Run: func(ctx context.Context, parentDir string, o Options, updateProgressBase func(func() float64) func(), sendWarning func(error)) {
+				opts, err := ParseDjxlOptions(o)
+				if err != nil {
+					sendWarning(err)
+					return
+				}
+				Djxl(ctx, parentDir, 1, opts, updateProgressBase, sendWarning)
+			},
+			Estimate: func(ctx context.Context, parentDir string, o Options, sample int) (SizeEstimate, error) {
+				opts, err := ParseDjxlOptions(o)
+				if err != nil {
+					return SizeEstimate{}, errNoEstimate
+				}
+				return EstimateDjxl(ctx, parentDir, opts, sample)
+			},
+		},
+	}
+)
+
+// Register adds a task to the registry, IDs must be unique.
+func Register(task Task) error {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	for _, t := range registry {
+		if t.ID == task.ID {
+			return fmt.Errorf("task '%s' is already registered", task.ID)
+		}
+	}
+	registry = append(registry, task)
+	return nil
+}
+
+// All returns the registered tasks in registration order.
+func All() []Task {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	return append([]Task{}, registry...)
+}
+
+// OptionsID returns the ID the task's options are stored under.
+func (t Task) OptionsID() string {
+	if t.OptionsOf != "" {
+		return t.OptionsOf
+	}
+	return t.ID
+}
+
+// WithProfile returns a copy of the task running with the options of the
+// named profile on top of its own.
+func (t Task) WithProfile(name string, opts Options) Task {
+	profile := Options{}
+	for key, value := range t.Profile {
+		profile[key] = value
+	}
+	for key, value := range opts {
+		profile[key] = value
+	}
+	t.OptionsOf = t.OptionsID()
+	t.ID = t.ID + "@" + name
+	t.Label = t.Label + " " + name
+	t.Profile = profile
+	return t
+}
+
+// Options returns the options the task runs with: the configured ones of
+// OptionsID(), overridden by the profile.
+func (t Task) Options(configured map[string]map[string]string) Options {
+	opts := Options{}
+	for key, value := range configured[t.OptionsID()] {
+		opts[key] = value
+	}
+	for key, value := range t.Profile {
+		opts[key] = value
+	}
+	return opts
+}
+
+// HasMatchingFiles reports whether parentDir has a file matching one of the
+// task's Match patterns, always true if the task has none.
+func (t Task) HasMatchingFiles(parentDir string) (bool, error) {
+	if len(t.Match) == 0 {
+		return true, nil
+	}
+
+	entries, err := os.ReadDir(parentDir)
+	if err != nil {
+		return false, fmt.Errorf("can't read directory: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if matchGlobs(t.Match, entry.Name()) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// matchGlobs reports whether the file name matches one of the glob patterns,
+// ignoring case.
+func matchGlobs(globs []string, fileName string) bool {
+	for _, glob := range globs {
+		if ok, _ := filepath.Match(strings.ToLower(glob), strings.ToLower(fileName)); ok {
+			return true
+		}
+	}
+	return false
+}
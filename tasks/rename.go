@@ -0,0 +1,370 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"exputils/undolog"
+	"exputils/utils"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// RenameUndoFile is written to the folder after a rename, it lists the
+// renames so they can be reverted.
+const RenameUndoFile = ".exputils-rename-undo.json"
+
+type RenameOptions struct {
+	Template string
+	// Start is the first value of the {n} counter.
+	Start int
+	// Match, if set, selects the files to rename by their stem and provides
+	// the capture groups.
+	Match *regexp.Regexp
+	Globs []string
+}
+
+func ParseRenameOptions(o Options) (RenameOptions, error) {
+	opts := RenameOptions{Template: o.String("template", "{n:3}")}
+	var err error
+	if opts.Start, err = o.Int("start", 1); err != nil {
+		return opts, err
+	}
+	if opts.Match, err = compileRenameMatch(o.String("match", "")); err != nil {
+		return opts, err
+	}
+	if opts.Globs, err = parseGlobs(o, []string{"*"}); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// renameStep renames From to To, both are file names in the same folder.
+type renameStep struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// planRename computes the new names of the files, in natural order, and
+// checks that no two files end up with the same name and that no file is
+// overwritten. Files keeping their name are left out.
+func planRename(parentDir string, opts RenameOptions) ([]renameStep, error) {
+	template, err := parseRenameTemplate(opts.Template, opts.Start)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(parentDir)
+	if err != nil {
+		return nil, fmt.Errorf("can't read directory: %w", err)
+	}
+	type candidate struct {
+		entry    os.DirEntry
+		captures []string
+	}
+	candidates := []candidate{}
+	existing := map[string]bool{}
+	for _, entry := range entries {
+		existing[strings.ToLower(entry.Name())] = true
+		if !entry.Type().IsRegular() || entry.Name() == RenameUndoFile || !matchGlobs(opts.Globs, entry.Name()) {
+			continue
+		}
+		var captures []string
+		if opts.Match != nil {
+			captures = opts.Match.FindStringSubmatch(strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())))
+			if captures == nil {
+				continue
+			}
+		}
+		candidates = append(candidates, candidate{entry, captures})
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no files to rename")
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return utils.NaturalLess(candidates[i].entry.Name(), candidates[j].entry.Name())
+	})
+
+	steps := []renameStep{}
+	renamedAway := map[string]bool{}
+	targets := map[string]string{}
+	errs := []error{}
+	for i, c := range candidates {
+		info, err := c.entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("can't stat '%s': %w", c.entry.Name(), err)
+		}
+		newName, err := template.render(renameInput{
+			dir:     parentDir,
+			name:    c.entry.Name(),
+			index:   i,
+			modTime: info.ModTime(),
+		}, c.captures)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		// names are compared ignoring case, a.jpg and A.jpg are the same file
+		// on Windows
+		key := strings.ToLower(newName)
+		if other, ok := targets[key]; ok {
+			errs = append(errs, fmt.Errorf("'%s' and '%s' would both be renamed to '%s'", other, c.entry.Name(), newName))
+			continue
+		}
+		targets[key] = c.entry.Name()
+		if newName != c.entry.Name() {
+			steps = append(steps, renameStep{From: c.entry.Name(), To: newName})
+			renamedAway[strings.ToLower(c.entry.Name())] = true
+		}
+	}
+
+	// a target may only exist if that file is itself renamed away
+	for _, step := range steps {
+		key := strings.ToLower(step.To)
+		if existing[key] && !renamedAway[key] && !strings.EqualFold(step.From, step.To) {
+			errs = append(errs, fmt.Errorf("renaming '%s' to '%s' would overwrite an existing file", step.From, step.To))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return steps, nil
+}
+
+// applyRename runs the steps in two passes, every file is first moved to a
+// temporary name then to its target, so swaps and chains (a->b, b->a) never
+// overwrite anything. If a rename fails the ones done so far are reverted,
+// the files that can't be are returned with the name they were left at, by
+// step index.
+func applyRename(ctx context.Context, parentDir string, steps []renameStep, progress func()) (map[int]string, error) {
+	type move struct {
+		step     int
+		from, to string
+	}
+	done := []move{}
+	rollback := func(cause error) (map[int]string, error) {
+		errs := []error{cause}
+		stuck := map[int]string{}
+		for i := len(done) - 1; i >= 0; i-- {
+			// the earlier moves of a file that couldn't be reverted are moot
+			if _, ok := stuck[done[i].step]; ok {
+				continue
+			}
+			if err := os.Rename(done[i].to, done[i].from); err != nil {
+				stuck[done[i].step] = filepath.Base(done[i].to)
+				errs = append(errs, fmt.Errorf("can't revert '%s': %w", filepath.Base(done[i].from), err))
+			}
+		}
+		return stuck, errors.Join(errs...)
+	}
+	rename := func(step int, from, to string) error {
+		if _, err := os.Lstat(to); err == nil && !strings.EqualFold(from, to) {
+			return fmt.Errorf("'%s' already exists", filepath.Base(to))
+		}
+		if err := os.Rename(from, to); err != nil {
+			return err
+		}
+		done = append(done, move{step, from, to})
+		return nil
+	}
+
+	tmpNames := make([]string, len(steps))
+	for i, step := range steps {
+		if err := ctx.Err(); err != nil {
+			return rollback(err)
+		}
+		tmpNames[i] = filepath.Join(parentDir, fmt.Sprintf(".exputils-rename-%d-%d.tmp", os.Getpid(), i))
+		if err := rename(i, filepath.Join(parentDir, step.From), tmpNames[i]); err != nil {
+			return rollback(fmt.Errorf("can't rename '%s': %w", step.From, err))
+		}
+	}
+	for i, step := range steps {
+		if err := rename(i, tmpNames[i], filepath.Join(parentDir, step.To)); err != nil {
+			return rollback(fmt.Errorf("can't rename '%s' to '%s': %w", step.From, step.To, err))
+		}
+		progress()
+	}
+	return nil, nil
+}
+
+// keepUndoFile writes the renames still to undo after a rollback that failed
+// to the undo file, so undoing can put the files left behind back later.
+func keepUndoFile(undoFile string, steps []renameStep, cause error) error {
+	data, err := json.MarshalIndent(steps, "", "  ")
+	if err == nil {
+		err = utils.WriteFileAtomic(undoFile, data, 0o644)
+	}
+	if err != nil {
+		return errors.Join(cause, fmt.Errorf("some files couldn't be put back and the undo file can't be written: %w", err))
+	}
+	return errors.Join(cause, fmt.Errorf("some files couldn't be put back, '%s' lists where they are, undo the rename to retry", undoFile))
+}
+
+// RenamePreview reports the renames the Rename task would do, and why it
+// would refuse to.
+func RenamePreview(
+	ctx context.Context,
+	parentDir string,
+	opts RenameOptions,
+	updateProgressBase func(func() float64) func(),
+	sendWarning func(error),
+) {
+	steps, err := planRename(parentDir, opts)
+	if err != nil {
+		sendWarning(err)
+		return
+	}
+	if len(steps) == 0 {
+		sendWarning(fmt.Errorf("all files already have their new name"))
+		return
+	}
+	for _, step := range steps {
+		sendWarning(Event{File: step.From, Output: step.To, Status: StatusPlanned})
+	}
+	updateProgressBase(func() float64 { return 1 })()
+}
+
+// Rename renames the files of the folder following the template and writes
+// RenameUndoFile so UndoRename can revert it.
+func Rename(
+	ctx context.Context,
+	parentDir string,
+	opts RenameOptions,
+	updateProgressBase func(func() float64) func(),
+	sendWarning func(error),
+) {
+	undoFile := filepath.Join(parentDir, RenameUndoFile)
+	if _, err := os.Stat(undoFile); err == nil {
+		sendWarning(fmt.Errorf("'%s' already exists, undo or delete it first", RenameUndoFile))
+		return
+	}
+
+	steps, err := planRename(parentDir, opts)
+	if err != nil {
+		sendWarning(err)
+		return
+	}
+	if len(steps) == 0 {
+		sendWarning(fmt.Errorf("all files already have their new name"))
+		return
+	}
+
+	// the undo file is written first, a rename that can't be undone isn't done
+	data, err := json.MarshalIndent(steps, "", "  ")
+	if err != nil {
+		sendWarning(err)
+		return
+	}
+	if err := utils.WriteFileAtomic(undoFile, data, 0o644); err != nil {
+		sendWarning(fmt.Errorf("can't write undo file: %w", err))
+		return
+	}
+
+	renamedFiles := 0
+	var progressMutex sync.Mutex
+	updateProgress := updateProgressBase(func() float64 {
+		progressMutex.Lock()
+		defer progressMutex.Unlock()
+		renamedFiles++
+		return float64(renamedFiles) / float64(len(steps))
+	})
+	if stuck, err := applyRename(ctx, parentDir, steps, updateProgress); err != nil {
+		if len(stuck) == 0 {
+			os.Remove(undoFile)
+			sendWarning(err)
+			return
+		}
+		// the other files are back at their name, nothing to undo for them
+		left := []renameStep{}
+		for i, step := range steps {
+			if at, ok := stuck[i]; ok {
+				left = append(left, renameStep{From: step.From, To: at})
+			}
+		}
+		sendWarning(keepUndoFile(undoFile, left, err))
+		return
+	}
+	for _, step := range steps {
+		sendWarning(Event{File: step.From, Output: step.To, Status: StatusRenamed})
+	}
+	recordRenames(ctx, parentDir, steps, sendWarning)
+	if err := undolog.FromContext(ctx).Created(undoFile); err != nil {
+		sendWarning(err)
+	}
+}
+
+// UndoRename reverts the renames listed in RenameUndoFile.
+func UndoRename(
+	ctx context.Context,
+	parentDir string,
+	updateProgressBase func(func() float64) func(),
+	sendWarning func(error),
+) {
+	undoFile := filepath.Join(parentDir, RenameUndoFile)
+	data, err := os.ReadFile(undoFile)
+	if errors.Is(err, os.ErrNotExist) {
+		sendWarning(fmt.Errorf("no rename to undo in this folder"))
+		return
+	} else if err != nil {
+		sendWarning(fmt.Errorf("can't read undo file: %w", err))
+		return
+	}
+	var steps []renameStep
+	if err := json.Unmarshal(data, &steps); err != nil {
+		sendWarning(fmt.Errorf("can't parse undo file: %w", err))
+		return
+	}
+
+	reverse := make([]renameStep, len(steps))
+	for i, step := range steps {
+		if _, err := os.Lstat(filepath.Join(parentDir, step.To)); err != nil {
+			sendWarning(fmt.Errorf("'%s' is gone, can't undo the rename", step.To))
+			return
+		}
+		reverse[i] = renameStep{From: step.To, To: step.From}
+	}
+
+	revertedFiles := 0
+	var progressMutex sync.Mutex
+	updateProgress := updateProgressBase(func() float64 {
+		progressMutex.Lock()
+		defer progressMutex.Unlock()
+		revertedFiles++
+		return float64(revertedFiles) / float64(len(reverse))
+	})
+	if stuck, err := applyRename(ctx, parentDir, reverse, updateProgress); err != nil {
+		if len(stuck) == 0 {
+			sendWarning(err)
+			return
+		}
+		// the other files are back at their renamed name, as listed
+		for i, at := range stuck {
+			steps[i].To = at
+		}
+		sendWarning(keepUndoFile(undoFile, steps, err))
+		return
+	}
+	if err := os.Remove(undoFile); err != nil {
+		sendWarning(fmt.Errorf("can't remove undo file: %w", err))
+	}
+	for _, step := range reverse {
+		sendWarning(Event{File: step.From, Output: step.To, Status: StatusRenamed})
+	}
+	recordRenames(ctx, parentDir, reverse, sendWarning)
+}
+
+// recordRenames adds the renames to the undo log of the run.
+func recordRenames(ctx context.Context, parentDir string, steps []renameStep, sendWarning func(error)) {
+	for _, step := range steps {
+		err := undolog.FromContext(ctx).Renamed(filepath.Join(parentDir, step.From), filepath.Join(parentDir, step.To))
+		if err != nil {
+			sendWarning(err)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package tasks
+
+import (
+	"exputils/imageinfo"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// renameInput is what a template can refer to for one file.
+type renameInput struct {
+	dir     string
+	name    string
+	index   int
+	modTime time.Time
+}
+
+// renameToken renders one {...} placeholder of a rename template.
+type renameToken func(in renameInput, captures []string) (string, error)
+
+// renameTemplate builds the new stem of a file, the extension is kept. It's
+// made of literal text and placeholders:
+//
+//	{n}, {n:3}          counter, optionally zero-padded to a width
+//	{stem}              original name without extension
+//	{1}, {2}, ...       capture groups of the match regex
+//	{date}, {date:...}  modification date, with an optional Go time layout
+//	{w}, {h}            image width and height
+type renameTemplate struct {
+	parts []renameToken
+	start int
+}
+
+func parseRenameTemplate(template string, start int) (renameTemplate, error) {
+	t := renameTemplate{start: start}
+	for len(template) > 0 {
+		open := strings.IndexByte(template, '{')
+		if open < 0 {
+			literal := template
+			t.parts = append(t.parts, func(renameInput, []string) (string, error) { return literal, nil })
+			break
+		}
+		if open > 0 {
+			literal := template[:open]
+			t.parts = append(t.parts, func(renameInput, []string) (string, error) { return literal, nil })
+		}
+		end := strings.IndexByte(template[open:], '}')
+		if end < 0 {
+			return t, fmt.Errorf("unclosed '{' in template")
+		}
+		token, err := parseRenameToken(template[open+1:open+end], start)
+		if err != nil {
+			return t, err
+		}
+		t.parts = append(t.parts, token)
+		template = template[open+end+1:]
+	}
+	if len(t.parts) == 0 {
+		return t, fmt.Errorf("empty template")
+	}
+	return t, nil
+}
+
+func parseRenameToken(token string, start int) (renameToken, error) {
+	name, arg, hasArg := strings.Cut(token, ":")
+
+	switch name {
+	case "n":
+		width := 0
+		if hasArg {
+			var err error
+			if width, err = strconv.Atoi(arg); err != nil || width < 0 {
+				return nil, fmt.Errorf("invalid counter width '%s'", arg)
+			}
+		}
+		return func(in renameInput, _ []string) (string, error) {
+			return fmt.Sprintf("%0*d", width, start+in.index), nil
+		}, nil
+
+	case "stem":
+		return func(in renameInput, _ []string) (string, error) {
+			return strings.TrimSuffix(in.name, filepath.Ext(in.name)), nil
+		}, nil
+
+	case "date":
+		layout := "2006-01-02"
+		if hasArg {
+			layout = arg
+		}
+		return func(in renameInput, _ []string) (string, error) {
+			return in.modTime.Format(layout), nil
+		}, nil
+
+	case "w", "h":
+		return func(in renameInput, _ []string) (string, error) {
+			width, height, err := imageDimensions(filepath.Join(in.dir, in.name))
+			if err != nil {
+				return "", err
+			}
+			if name == "w" {
+				return strconv.Itoa(width), nil
+			}
+			return strconv.Itoa(height), nil
+		}, nil
+	}
+
+	if group, err := strconv.Atoi(name); err == nil && group > 0 && !hasArg {
+		return func(in renameInput, captures []string) (string, error) {
+			if group >= len(captures) {
+				return "", fmt.Errorf("'%s' has no capture group %d", in.name, group)
+			}
+			return captures[group], nil
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown placeholder '{%s}'", token)
+}
+
+func (t renameTemplate) render(in renameInput, captures []string) (string, error) {
+	var sb strings.Builder
+	for _, part := range t.parts {
+		s, err := part(in, captures)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(s)
+	}
+	stem := sb.String()
+	if stem == "" || strings.ContainsAny(stem, `/\:*?"<>|`) {
+		return "", fmt.Errorf("template gives invalid name '%s' for '%s'", stem, in.name)
+	}
+	return stem + filepath.Ext(in.name), nil
+}
+
+// imageDimensions reads the size of an image from its header, JXL included.
+func imageDimensions(path string) (int, int, error) {
+	info, err := imageinfo.Read(path)
+	if err == nil && (info.Width == 0 || info.Height == 0) {
+		err = fmt.Errorf("no dimensions in %s header", info.Format)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("can't read dimensions of '%s': %w", filepath.Base(path), err)
+	}
+	return info.Width, info.Height, nil
+}
+
+// compileRenameMatch compiles the optional regex selecting the files to
+// rename and providing capture groups, it's matched against the stem.
+func compileRenameMatch(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid match regex: %w", err)
+	}
+	return re, nil
+}
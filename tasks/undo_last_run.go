@@ -0,0 +1,110 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"exputils/undolog"
+	"fmt"
+	"path/filepath"
+)
+
+// UndoMode tells what UndoLastRun does with the last run.
+type UndoMode string
+
+const (
+	// UndoSafe leaves the files modified since the run as they are, they
+	// stay in its log.
+	UndoSafe UndoMode = "safe"
+	// UndoForce reverts the modified files too.
+	UndoForce UndoMode = "force"
+	// UndoSkip sets the run aside without reverting anything, the next undo
+	// reverts the run before it.
+	UndoSkip UndoMode = "skip"
+)
+
+func ParseUndoMode(o Options) (UndoMode, error) {
+	mode := UndoMode(o.String("mode", string(UndoSafe)))
+	switch mode {
+	case UndoSafe, UndoForce, UndoSkip:
+		return mode, nil
+	}
+	return mode, fmt.Errorf("option 'mode' must be 'safe', 'force' or 'skip', got '%s'", mode)
+}
+
+// UndoLastRun reverts the files created, renamed and moved by the most recent
+// run that changed any. Files modified since that run are left as they are
+// and stay in its log, unless the mode forces them or skips the run.
+func UndoLastRun(
+	ctx context.Context,
+	mode UndoMode,
+	updateProgressBase func(func() float64) func(),
+	sendWarning func(error),
+) {
+	dir, err := undolog.Dir()
+	if err != nil {
+		sendWarning(err)
+		return
+	}
+	run, err := undolog.Last(dir)
+	if err != nil {
+		sendWarning(err)
+		return
+	}
+	if run == nil {
+		sendWarning(fmt.Errorf("no run to undo"))
+		return
+	}
+	if ctx.Err() != nil {
+		sendWarning(ctx.Err())
+		return
+	}
+
+	started := run.Started.Format("2006-01-02 15:04:05")
+	if mode == UndoSkip {
+		if err := run.Skip(); err != nil {
+			sendWarning(fmt.Errorf("can't skip %s of %s: %w", run.TaskID, started, err))
+			return
+		}
+		sendWarning(Event{File: run.Folder, Status: StatusSkipped, Message: fmt.Sprintf("%s of %s set aside, the next undo reverts the run before it", run.TaskID, started)})
+		updateProgressBase(func() float64 { return 1 })()
+		return
+	}
+
+	sendWarning(Event{
+		File:    run.Folder,
+		Message: fmt.Sprintf("undoing %s of %s", run.TaskID, started),
+	})
+
+	// paths are shown relative to the folder the run worked on
+	relative := func(path string) string {
+		if rel, err := filepath.Rel(run.Folder, path); err == nil {
+			return rel
+		}
+		return path
+	}
+
+	revertedEntries, modified := 0, 0
+	err = run.Undo(mode == UndoForce, func(entry undolog.Entry, err error) {
+		revertedEntries++
+		progress := float64(revertedEntries) / float64(len(run.Entries))
+		updateProgressBase(func() float64 { return progress })()
+
+		switch {
+		case errors.Is(err, undolog.ErrModified):
+			modified++
+			sendWarning(err)
+		case err != nil:
+			sendWarning(err)
+		case entry.Op == undolog.OpCreate:
+			sendWarning(Event{File: relative(entry.Path), Status: StatusRemoved})
+		default:
+			sendWarning(Event{File: relative(entry.Path), Output: relative(entry.From), Status: StatusMoved, Message: "moved back"})
+		}
+	})
+	if err != nil {
+		sendWarning(fmt.Errorf("can't update undo log: %w", err))
+	}
+	if modified > 0 {
+		sendWarning(fmt.Errorf("%d files modified since %s of %s were kept, undo again to force them or skip the run", modified, run.TaskID, started))
+	}
+}
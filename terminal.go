@@ -0,0 +1,71 @@
+package main
+
+import (
+	"exputils/config"
+	"exputils/notify"
+	"io"
+	"os"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// terminal is the output of the program, the notifications write their
+// escape sequences through it between the frames of the renderer.
+var terminal = &terminalOutput{File: os.Stdout}
+
+// terminalOutput serializes the writes to the terminal. It stays a file so
+// the program still finds the terminal behind it.
+type terminalOutput struct {
+	*os.File
+	mutex sync.Mutex
+}
+
+func (t *terminalOutput) Write(p []byte) (int, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.File.Write(p)
+}
+
+func (t *terminalOutput) WriteString(s string) (int, error) {
+	return t.Write([]byte(s))
+}
+
+// NotifiedMsg comes once a notification is written or its command ran.
+type NotifiedMsg struct{ err error }
+
+// writeTerminal writes escape sequences through the program's output.
+func writeTerminal(sequences string) tea.Cmd {
+	return func() tea.Msg {
+		_, err := io.WriteString(terminal, sequences)
+		return NotifiedMsg{err}
+	}
+}
+
+// notifyStarted puts the title back as a run starts.
+func notifyStarted(cfg config.Notifications) tea.Cmd {
+	if title := notify.Started(cfg); title != "" {
+		return tea.SetWindowTitle(title)
+	}
+	return nil
+}
+
+// notifyFinished announces the end of a run, the title through the program
+// and the hook command in the background.
+func notifyFinished(cfg config.Notifications, summary notify.Summary) tea.Cmd {
+	n, err := notify.Finished(cfg, summary)
+	if err != nil {
+		return func() tea.Msg { return NotifiedMsg{err} }
+	}
+	cmds := []tea.Cmd{}
+	if n.Title != "" {
+		cmds = append(cmds, tea.SetWindowTitle(n.Title))
+	}
+	if n.Sequences != "" {
+		cmds = append(cmds, writeTerminal(n.Sequences))
+	}
+	if len(n.Command) > 0 {
+		cmds = append(cmds, func() tea.Msg { return NotifiedMsg{notify.RunCommand(n.Command, summary)} })
+	}
+	return tea.Batch(cmds...)
+}
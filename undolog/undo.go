@@ -0,0 +1,147 @@
+package undolog
+
+import (
+	"encoding/json"
+	"errors"
+	"exputils/utils"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+var (
+	// ErrModified is returned for files changed since the run, they're left
+	// alone unless the undo is forced.
+	ErrModified = errors.New("modified since the run, left as is")
+	// errGone is returned for files deleted since the run, there's nothing
+	// left to revert.
+	errGone = errors.New("no longer exists")
+)
+
+// unchanged reports whether the file at entry.Path is still the one recorded,
+// with force only whether it still exists.
+func unchanged(entry Entry, force bool) error {
+	info, err := os.Stat(entry.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("'%s' %w", entry.Path, errGone)
+	} else if err != nil {
+		return err
+	}
+	if !force && (info.Size() != entry.Size || !info.ModTime().Equal(entry.ModTime)) {
+		return fmt.Errorf("'%s' %w", entry.Path, ErrModified)
+	}
+	return nil
+}
+
+// revert undoes a created or trashed file.
+func revert(entry Entry, force bool) error {
+	switch entry.Op {
+	case OpCreate:
+		if err := unchanged(entry, force); err != nil {
+			return err
+		}
+		return os.Remove(entry.Path)
+	case OpTrash:
+		return fmt.Errorf("'%s' was moved to the trash, restore it from there", entry.Path)
+	}
+	return fmt.Errorf("unknown operation '%s'", entry.Op)
+}
+
+// revertMoves moves renamed and moved files back. Like the rename task it goes
+// through temporary names, so chains and swaps (a->b, b->a) can be reverted.
+// It returns the error of every entry, nil for the reverted ones.
+func revertMoves(entries []Entry, force bool) []error {
+	errs := make([]error, len(entries))
+	tmpNames := make([]string, len(entries))
+	for i, entry := range entries {
+		if errs[i] = unchanged(entry, force); errs[i] != nil {
+			continue
+		}
+		tmpNames[i] = fmt.Sprintf("%s.exputils-undo-%d-%d.tmp", entry.Path, os.Getpid(), i)
+		if err := os.Rename(entry.Path, tmpNames[i]); err != nil {
+			errs[i] = fmt.Errorf("can't move '%s' back: %w", entry.Path, err)
+		}
+	}
+	for i, entry := range entries {
+		if errs[i] != nil {
+			continue
+		}
+		if _, err := os.Lstat(entry.From); err == nil {
+			errs[i] = fmt.Errorf("can't move '%s' back, '%s' exists again", entry.Path, entry.From)
+		} else if err := os.MkdirAll(filepath.Dir(entry.From), 0o755); err != nil {
+			errs[i] = err
+		} else if err := os.Rename(tmpNames[i], entry.From); err != nil {
+			errs[i] = fmt.Errorf("can't move '%s' back: %w", entry.Path, err)
+		}
+		if errs[i] != nil {
+			if err := os.Rename(tmpNames[i], entry.Path); err != nil {
+				errs[i] = errors.Join(errs[i], fmt.Errorf("'%s' is left as '%s'", entry.Path, tmpNames[i]))
+			}
+		}
+	}
+	return errs
+}
+
+// Undo reverts the entries of the run, newest first, and calls onEntry after
+// each one. With force, files modified since the run are reverted too.
+// Reverted entries, and those that can't ever be, are dropped from the log,
+// the log file is removed once nothing is left to revert.
+func (r *Run) Undo(force bool, onEntry func(entry Entry, err error)) error {
+	keep := []Entry{}
+	for end := len(r.Entries); end > 0; {
+		// consecutive renames and moves are reverted together
+		start := end - 1
+		for start > 0 && isMove(r.Entries[start]) && isMove(r.Entries[start-1]) {
+			start--
+		}
+		batch := r.Entries[start:end]
+		var errs []error
+		if isMove(batch[0]) {
+			errs = revertMoves(batch, force)
+		} else {
+			errs = []error{revert(batch[0], force)}
+		}
+		for i := len(batch) - 1; i >= 0; i-- {
+			onEntry(batch[i], errs[i])
+		}
+		// trashed and deleted files can't be restored, keeping them in the
+		// log would block the entries of older runs forever
+		failed := []Entry{}
+		for i, entry := range batch {
+			if errs[i] != nil && entry.Op != OpTrash && !errors.Is(errs[i], errGone) {
+				failed = append(failed, entry)
+			}
+		}
+		keep = append(failed, keep...)
+		end = start
+	}
+
+	if len(keep) == 0 {
+		return os.Remove(r.Path)
+	}
+
+	r.Entries = keep
+	data, err := json.Marshal(header{TaskID: r.TaskID, Folder: r.Folder, Started: r.Started})
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	for _, entry := range keep {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+	return utils.WriteFileAtomic(r.Path, data, 0o644)
+}
+
+// Skip sets the run aside without reverting it, so Last returns the run before
+// it. The log is kept next to the others with a .skipped suffix.
+func (r *Run) Skip() error {
+	return os.Rename(r.Path, r.Path+".skipped")
+}
+
+func isMove(entry Entry) bool {
+	return entry.Op == OpRename || entry.Op == OpMove
+}
@@ -0,0 +1,234 @@
+// Package undolog records the files a task run creates, renames, moves or
+// deletes, so the run can be reverted later. Every run gets its own log,
+// written as JSON lines as the operations happen.
+package undolog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"exputils/config"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Op string
+
+const (
+	OpCreate Op = "create"
+	OpRename Op = "rename"
+	OpMove   Op = "move"
+	// OpTrash is a file moved to the trash, it can't be restored
+	// automatically.
+	OpTrash Op = "trash"
+)
+
+// Entry is one recorded operation. Size and ModTime are those of Path right
+// after the operation, they tell whether the file changed since.
+type Entry struct {
+	Op      Op        `json:"op"`
+	Path    string    `json:"path"`
+	From    string    `json:"from,omitempty"`
+	Size    int64     `json:"size,omitempty"`
+	ModTime time.Time `json:"modTime,omitempty"`
+}
+
+// Dir returns the directory the run logs are kept in.
+func Dir() (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "undo"), nil
+}
+
+// header is the first line of a log file.
+type header struct {
+	TaskID  string    `json:"taskId"`
+	Folder  string    `json:"folder"`
+	Started time.Time `json:"started"`
+}
+
+// Log is the undo log of a single run. A nil *Log records nothing, so tasks
+// can call it whether or not they run with one.
+type Log struct {
+	mutex  sync.Mutex
+	path   string
+	header header
+	file   *os.File
+	// closed is set by Close, the run is over and nothing more is recorded
+	closed bool
+}
+
+// New prepares the log of a run in dir, the file is only created once the
+// first operation is recorded.
+func New(dir, taskID, folder string) *Log {
+	started := time.Now()
+	name := fmt.Sprintf("%s-%s.jsonl", started.Format("20060102-150405.000"), sanitize(taskID))
+	return &Log{
+		path:   filepath.Join(dir, name),
+		header: header{TaskID: taskID, Folder: folder, Started: started},
+	}
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+func (l *Log) append(entry Entry) error {
+	if l == nil {
+		return nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.closed {
+		return fmt.Errorf("can't record '%s' in the undo log, the run is over", filepath.Base(entry.Path))
+	}
+	if l.file == nil {
+		if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+			return fmt.Errorf("can't create undo log directory: %w", err)
+		}
+		file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("can't create undo log: %w", err)
+		}
+		l.file = file
+		if err := json.NewEncoder(l.file).Encode(l.header); err != nil {
+			return fmt.Errorf("can't write undo log: %w", err)
+		}
+	}
+	if err := json.NewEncoder(l.file).Encode(entry); err != nil {
+		return fmt.Errorf("can't write undo log: %w", err)
+	}
+	return nil
+}
+
+func (l *Log) record(op Op, path, from string) error {
+	if l == nil {
+		return nil
+	}
+	entry := Entry{Op: op, Path: path, From: from}
+	if op != OpTrash {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("can't record '%s' in the undo log: %w", filepath.Base(path), err)
+		}
+		entry.Size, entry.ModTime = info.Size(), info.ModTime()
+	}
+	return l.append(entry)
+}
+
+// Created records a file the run created.
+func (l *Log) Created(path string) error { return l.record(OpCreate, path, "") }
+
+// Renamed records a file renamed within its folder.
+func (l *Log) Renamed(from, to string) error { return l.record(OpRename, to, from) }
+
+// Moved records a file moved to another folder.
+func (l *Log) Moved(from, to string) error { return l.record(OpMove, to, from) }
+
+// Trashed records a file moved to the trash.
+func (l *Log) Trashed(path string) error { return l.record(OpTrash, path, "") }
+
+// Close closes the log file, if one was created. Operations recorded after it
+// return an error.
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.closed = true
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying the log.
+func NewContext(ctx context.Context, l *Log) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the log of the context, nil if there's none.
+func FromContext(ctx context.Context) *Log {
+	l, _ := ctx.Value(contextKey{}).(*Log)
+	return l
+}
+
+// Run is a log read back from disk.
+type Run struct {
+	Path    string
+	TaskID  string
+	Folder  string
+	Started time.Time
+	Entries []Entry
+}
+
+// Read reads a log file.
+func Read(path string) (*Run, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	if !scanner.Scan() {
+		return nil, fmt.Errorf("undo log '%s' is empty", filepath.Base(path))
+	}
+	var h header
+	if err := json.Unmarshal(scanner.Bytes(), &h); err != nil {
+		return nil, fmt.Errorf("can't parse undo log: %w", err)
+	}
+	run := &Run{Path: path, TaskID: h.TaskID, Folder: h.Folder, Started: h.Started}
+	for scanner.Scan() {
+		var entry Entry
+		// the last line may be cut short if exputils was killed mid-write
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			break
+		}
+		run.Entries = append(run.Entries, entry)
+	}
+	return run, scanner.Err()
+}
+
+// Last returns the most recent run logged in dir, nil if there's none.
+// Skipped runs are left out.
+func Last(dir string) (*Run, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("can't read undo log directory: %w", err)
+	}
+	names := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".jsonl") {
+			names = append(names, entry.Name())
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	// names start with the timestamp
+	sort.Strings(names)
+	return Read(filepath.Join(dir, names[len(names)-1]))
+}
@@ -0,0 +1,13 @@
+//go:build !windows && !linux && !darwin && !freebsd
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+)
+
+// FreeSpace isn't known on this system, the space check is skipped.
+func FreeSpace(path string) (uint64, error) {
+	return 0, fmt.Errorf("can't get free space of '%s': %w", path, errors.ErrUnsupported)
+}
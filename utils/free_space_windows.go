@@ -0,0 +1,23 @@
+//go:build windows
+
+package utils
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows"
+)
+
+// FreeSpace returns the bytes available to the user on the volume holding
+// path, which must exist.
+func FreeSpace(path string) (uint64, error) {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var free uint64
+	if err := windows.GetDiskFreeSpaceEx(pathPtr, &free, nil, nil); err != nil {
+		return 0, fmt.Errorf("can't get free space of '%s': %w", path, err)
+	}
+	return free, nil
+}
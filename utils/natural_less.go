@@ -0,0 +1,47 @@
+package utils
+
+import "strings"
+
+// NaturalLess compares strings the way people sort file names, numbers are
+// compared by value so "2.jpg" comes before "10.jpg". Case is ignored unless
+// the strings are otherwise equal.
+func NaturalLess(a, b string) bool {
+	la, lb := strings.ToLower(a), strings.ToLower(b)
+	i, j := 0, 0
+	for i < len(la) && j < len(lb) {
+		ca, cb := la[i], lb[j]
+		if isDigit(ca) && isDigit(cb) {
+			startA, startB := i, j
+			for i < len(la) && isDigit(la[i]) {
+				i++
+			}
+			for j < len(lb) && isDigit(lb[j]) {
+				j++
+			}
+			numA := strings.TrimLeft(la[startA:i], "0")
+			numB := strings.TrimLeft(lb[startB:j], "0")
+			if len(numA) != len(numB) {
+				return len(numA) < len(numB)
+			}
+			if numA != numB {
+				return numA < numB
+			}
+			// same value, fewer leading zeros first
+			if i-startA != j-startB {
+				return i-startA < j-startB
+			}
+			continue
+		}
+		if ca != cb {
+			return ca < cb
+		}
+		i++
+		j++
+	}
+	if len(la)-i != len(lb)-j {
+		return len(la)-i < len(lb)-j
+	}
+	return a < b
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
@@ -0,0 +1,24 @@
+//go:build !windows
+
+package utils
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// OpenFile opens a file in the program the system associates with it, it
+// doesn't wait for the program to exit.
+func OpenFile(path string) error {
+	opener := "xdg-open"
+	if runtime.GOOS == "darwin" {
+		opener = "open"
+	}
+	cmd := exec.Command(opener, path)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("can't open '%s': %w", path, err)
+	}
+	go cmd.Wait()
+	return nil
+}
@@ -0,0 +1,70 @@
+//go:build !windows
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// MoveToTrash moves a file to the home trash of the FreeDesktop.org trash
+// spec, the file must be on the same filesystem as the trash directory.
+func MoveToTrash(path string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("can't find trash directory: %w", err)
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	filesDir := filepath.Join(dataHome, "Trash", "files")
+	infoDir := filepath.Join(dataHome, "Trash", "info")
+	if err := os.MkdirAll(filesDir, 0o700); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(infoDir, 0o700); err != nil {
+		return err
+	}
+
+	// reserve a name by creating its .trashinfo file exclusively
+	base := filepath.Base(absPath)
+	ext := filepath.Ext(base)
+	for i := 1; ; i++ {
+		name := base
+		if i > 1 {
+			name = fmt.Sprintf("%s.%d%s", strings.TrimSuffix(base, ext), i, ext)
+		}
+		infoPath := filepath.Join(infoDir, name+".trashinfo")
+		info, err := os.OpenFile(infoPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		escaped := (&url.URL{Path: absPath}).EscapedPath()
+		_, err = fmt.Fprintf(info, "[Trash Info]\nPath=%s\nDeletionDate=%s\n", escaped, time.Now().Format("2006-01-02T15:04:05"))
+		info.Close()
+		if err != nil {
+			os.Remove(infoPath)
+			return err
+		}
+
+		if err := os.Rename(absPath, filepath.Join(filesDir, name)); err != nil {
+			os.Remove(infoPath)
+			return fmt.Errorf("can't move '%s' to the trash: %w", path, err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,287 @@
+// Package webhook posts the lifecycle events of the task runs to the URLs of
+// the config. Deliveries happen in the background, with a queue per hook, so
+// sending never waits on the network.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"exputils/config"
+	"exputils/report"
+	"exputils/tasks"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTimeout = 10 * time.Second
+	defaultRetries = 3
+	// queueSize is how many payloads wait for a slow hook before new ones
+	// are dropped.
+	queueSize = 64
+
+	// SignatureHeader holds "sha256=" and the hex HMAC-SHA256 of the body,
+	// keyed with the secret of the hook.
+	SignatureHeader = "X-Exputils-Signature"
+	// EventHeader repeats the event of the payload.
+	EventHeader = "X-Exputils-Event"
+)
+
+type Event string
+
+const (
+	EventStart   Event = "start"
+	EventFinish  Event = "finish"
+	EventFailure Event = "failure"
+	EventCancel  Event = "cancel"
+)
+
+// maxErrors is how many error messages a payload carries at most.
+const maxErrors = 20
+
+// Payload is the JSON body of a delivery.
+type Payload struct {
+	Event   Event     `json:"event"`
+	TaskID  string    `json:"taskId"`
+	Folder  string    `json:"folder"`
+	Started time.Time `json:"started"`
+	// Ended and the counts are only set once the run is over.
+	Ended       *time.Time     `json:"ended,omitempty"`
+	Files       int            `json:"files"`
+	Failed      int            `json:"failed"`
+	Counts      map[string]int `json:"counts,omitempty"`
+	InputBytes  int64          `json:"inputBytes"`
+	OutputBytes int64          `json:"outputBytes"`
+	// BytesSaved is the input minus the output, negative when the outputs
+	// are bigger.
+	BytesSaved int64    `json:"bytesSaved"`
+	Errors     []string `json:"errors,omitempty"`
+}
+
+// StartPayload is the payload of a run starting.
+func StartPayload(taskID, folder string, started time.Time) Payload {
+	return Payload{Event: EventStart, TaskID: taskID, Folder: folder, Started: started}
+}
+
+// EndPayload is the payload of a finished run: cancel, failure if any file
+// failed, finish otherwise.
+func EndPayload(r report.Report) Payload {
+	p := Payload{
+		Event:       EventFinish,
+		TaskID:      r.TaskID,
+		Folder:      r.Folder,
+		Started:     r.Started,
+		Ended:       &r.Ended,
+		Files:       r.Totals.Files,
+		Failed:      r.Totals.Failed,
+		Counts:      r.Totals.ByStatus,
+		InputBytes:  r.Totals.InputSize,
+		OutputBytes: r.Totals.OutputSize,
+		BytesSaved:  r.Totals.InputSize - r.Totals.OutputSize,
+	}
+	switch {
+	case r.Canceled:
+		p.Event = EventCancel
+	case r.Totals.Failed > 0:
+		p.Event = EventFailure
+	}
+	for _, row := range r.Files {
+		if row.Status == string(tasks.StatusFailed) && len(p.Errors) < maxErrors {
+			p.Errors = append(p.Errors, fmt.Sprintf("%s: %s", row.Input, row.Message))
+		}
+	}
+	for _, message := range r.Messages {
+		if len(p.Errors) < maxErrors {
+			p.Errors = append(p.Errors, message)
+		}
+	}
+	return p
+}
+
+// Sign returns the signature header value of a body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// delivery is a queued payload.
+type delivery struct {
+	event Event
+	body  []byte
+}
+
+// hook is a configured URL with its own queue.
+type hook struct {
+	config.Webhook
+	queue chan delivery
+}
+
+// Dispatcher delivers the payloads to every hook of the config. A nil
+// *Dispatcher sends nothing.
+type Dispatcher struct {
+	hooks   []*hook
+	client  *http.Client
+	onError func(error)
+	// backoff is the wait before the n-th retry
+	backoff func(n int) time.Duration
+	wg      sync.WaitGroup
+
+	mutex  sync.Mutex
+	closed bool
+}
+
+// New starts the delivery of each hook, onError gets the failed deliveries
+// and is called from the background.
+func New(hooks []config.Webhook, onError func(error)) (*Dispatcher, error) {
+	d := &Dispatcher{
+		client:  &http.Client{},
+		onError: onError,
+		backoff: func(n int) time.Duration { return time.Second << n },
+	}
+	for _, h := range hooks {
+		if h.URL == "" {
+			return nil, errors.New("webhook without url")
+		}
+		for _, event := range h.Events {
+			if !slices.Contains([]Event{EventStart, EventFinish, EventFailure, EventCancel}, Event(event)) {
+				return nil, fmt.Errorf("webhook '%s' has unknown event '%s'", h.URL, event)
+			}
+		}
+		d.hooks = append(d.hooks, &hook{Webhook: h, queue: make(chan delivery, queueSize)})
+	}
+	for _, h := range d.hooks {
+		d.wg.Add(1)
+		go d.deliver(h)
+	}
+	return d, nil
+}
+
+// Send queues the payload for every hook taking its event, it never blocks.
+// Payloads for a hook with a full queue, or sent after Close, are dropped.
+func (d *Dispatcher) Send(p Payload) {
+	if d == nil || len(d.hooks) == 0 {
+		return
+	}
+	body, err := json.Marshal(p)
+	if err != nil {
+		d.onError(err)
+		return
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.closed {
+		return
+	}
+	for _, h := range d.hooks {
+		if len(h.Events) > 0 && !slices.Contains(h.Events, string(p.Event)) {
+			continue
+		}
+		select {
+		case h.queue <- delivery{p.Event, body}:
+		default:
+			d.onError(fmt.Errorf("webhook '%s' is too slow, dropped '%s' of %s", h.URL, p.Event, p.TaskID))
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(h *hook) {
+	defer d.wg.Done()
+	for delivery := range h.queue {
+		if err := d.post(h, delivery.event, delivery.body); err != nil {
+			d.onError(fmt.Errorf("webhook '%s' failed on '%s': %w", h.URL, delivery.event, err))
+		}
+	}
+}
+
+// post tries a delivery until it succeeds, fails for good, or runs out of
+// retries. Network errors, 429 and 5xx are retried.
+func (d *Dispatcher) post(h *hook, event Event, body []byte) error {
+	timeout := time.Duration(h.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	retries := h.Retries
+	if retries == 0 {
+		retries = defaultRetries
+	}
+
+	var err error
+	for attempt := 0; attempt <= max(retries, 0); attempt++ {
+		if attempt > 0 {
+			time.Sleep(d.backoff(attempt - 1))
+		}
+		var retry bool
+		retry, err = d.attempt(h, event, body, timeout)
+		if err == nil || !retry {
+			return err
+		}
+	}
+	return err
+}
+
+func (d *Dispatcher) attempt(h *hook, event Event, body []byte, timeout time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, string(event))
+	if h.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(h.Secret, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("status %s", resp.Status)
+	}
+	return false, fmt.Errorf("status %s", resp.Status)
+}
+
+// Close stops taking payloads and waits for the queued ones to be delivered,
+// at most until ctx is done.
+func (d *Dispatcher) Close(ctx context.Context) {
+	if d == nil {
+		return
+	}
+	d.mutex.Lock()
+	if !d.closed {
+		d.closed = true
+		for _, h := range d.hooks {
+			close(h.queue)
+		}
+	}
+	d.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
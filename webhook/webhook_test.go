@@ -0,0 +1,277 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"exputils/config"
+	"exputils/report"
+	"exputils/tasks"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestDispatcher returns a dispatcher retrying right away, its errors are
+// sent to the returned channel.
+func newTestDispatcher(t *testing.T, hooks ...config.Webhook) (*Dispatcher, <-chan error) {
+	t.Helper()
+	errs := make(chan error, 2*queueSize)
+	d, err := New(hooks, func(err error) { errs <- err })
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.backoff = func(int) time.Duration { return 0 }
+	return d, errs
+}
+
+// closeDispatcher waits for the queued deliveries.
+func closeDispatcher(t *testing.T, d *Dispatcher) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	d.Close(ctx)
+	if ctx.Err() != nil {
+		t.Fatal("deliveries still pending")
+	}
+}
+
+func payload() Payload {
+	return StartPayload("convert", "/photos", time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+}
+
+func TestSignature(t *testing.T) {
+	type received struct {
+		body      []byte
+		signature string
+		event     string
+	}
+	got := make(chan received, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got <- received{body, r.Header.Get(SignatureHeader), r.Header.Get(EventHeader)}
+	}))
+	defer server.Close()
+
+	d, errs := newTestDispatcher(t, config.Webhook{URL: server.URL, Secret: "s3cret"})
+	d.Send(payload())
+	closeDispatcher(t, d)
+
+	r := <-got
+	if r.signature != Sign("s3cret", r.body) {
+		t.Errorf("signature %q doesn't match the body", r.signature)
+	}
+	if r.signature == Sign("other", r.body) {
+		t.Error("signature doesn't depend on the secret")
+	}
+	if r.event != string(EventStart) {
+		t.Errorf("event header %q, want %q", r.event, EventStart)
+	}
+	var p Payload
+	if err := json.Unmarshal(r.body, &p); err != nil || p.TaskID != "convert" {
+		t.Errorf("body %s isn't the payload: %v", r.body, err)
+	}
+	select {
+	case err := <-errs:
+		t.Errorf("unexpected error: %v", err)
+	default:
+	}
+}
+
+func TestUnsignedWithoutSecret(t *testing.T) {
+	got := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got <- r.Header.Get(SignatureHeader)
+	}))
+	defer server.Close()
+
+	d, _ := newTestDispatcher(t, config.Webhook{URL: server.URL})
+	d.Send(payload())
+	closeDispatcher(t, d)
+	if signature := <-got; signature != "" {
+		t.Errorf("signature %q sent without a secret", signature)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	for _, tt := range []struct {
+		status   int
+		attempts int32
+	}{
+		{http.StatusInternalServerError, 3},
+		{http.StatusBadGateway, 3},
+		{http.StatusTooManyRequests, 3},
+		{http.StatusBadRequest, 1},
+		{http.StatusNotFound, 1},
+	} {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts.Add(1)
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			d, errs := newTestDispatcher(t, config.Webhook{URL: server.URL, Retries: 2})
+			d.Send(payload())
+			closeDispatcher(t, d)
+
+			if n := attempts.Load(); n != tt.attempts {
+				t.Errorf("%d attempts, want %d", n, tt.attempts)
+			}
+			select {
+			case err := <-errs:
+				if !strings.Contains(err.Error(), http.StatusText(tt.status)) {
+					t.Errorf("error %q doesn't tell the status", err)
+				}
+			default:
+				t.Error("failed delivery not reported")
+			}
+		})
+	}
+}
+
+func TestRetrySucceeds(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	d, errs := newTestDispatcher(t, config.Webhook{URL: server.URL})
+	d.Send(payload())
+	closeDispatcher(t, d)
+
+	if n := attempts.Load(); n != 3 {
+		t.Errorf("%d attempts, want 3", n)
+	}
+	select {
+	case err := <-errs:
+		t.Errorf("unexpected error: %v", err)
+	default:
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	d, errs := newTestDispatcher(t, config.Webhook{URL: server.URL, TimeoutSeconds: 1, Retries: -1})
+	started := time.Now()
+	d.Send(payload())
+	closeDispatcher(t, d)
+
+	if elapsed := time.Since(started); elapsed > 3*time.Second {
+		t.Errorf("delivery took %s with a 1s timeout", elapsed)
+	}
+	select {
+	case err := <-errs:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("error %q isn't a timeout", err)
+		}
+	default:
+		t.Error("timed out delivery not reported")
+	}
+}
+
+func TestEvents(t *testing.T) {
+	got := make(chan string, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got <- r.Header.Get(EventHeader)
+	}))
+	defer server.Close()
+
+	d, _ := newTestDispatcher(t, config.Webhook{URL: server.URL, Events: []string{"failure"}})
+	d.Send(payload())
+	d.Send(EndPayload(report.Report{Totals: report.Totals{Failed: 1}}))
+	closeDispatcher(t, d)
+
+	close(got)
+	events := []string{}
+	for event := range got {
+		events = append(events, event)
+	}
+	if len(events) != 1 || events[0] != string(EventFailure) {
+		t.Errorf("got events %v, want only failure", events)
+	}
+}
+
+func TestEndPayload(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		report report.Report
+		event  Event
+	}{
+		{"finish", report.Report{Totals: report.Totals{Files: 2}}, EventFinish},
+		{"failure", report.Report{Totals: report.Totals{Files: 2, Failed: 1}}, EventFailure},
+		{"cancel", report.Report{Canceled: true, Totals: report.Totals{Files: 2, Failed: 1}}, EventCancel},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if p := EndPayload(tt.report); p.Event != tt.event {
+				t.Errorf("event %q, want %q", p.Event, tt.event)
+			}
+		})
+	}
+
+	p := EndPayload(report.Report{
+		TaskID:   "convert",
+		Totals:   report.Totals{Files: 2, Failed: 1, InputSize: 300, OutputSize: 100},
+		Files:    []report.Row{{Input: "a.jpg", Status: string(tasks.StatusFailed), Message: "bad header"}, {Input: "b.jpg", Status: string(tasks.StatusConverted)}},
+		Messages: []string{"no space left"},
+	})
+	if p.Ended == nil {
+		t.Error("ended not set")
+	}
+	if p.BytesSaved != 200 {
+		t.Errorf("bytes saved %d, want 200", p.BytesSaved)
+	}
+	if want := []string{"a.jpg: bad header", "no space left"}; strings.Join(p.Errors, "|") != strings.Join(want, "|") {
+		t.Errorf("errors %q, want %q", p.Errors, want)
+	}
+}
+
+func TestFullQueueDrops(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+
+	d, errs := newTestDispatcher(t, config.Webhook{URL: server.URL})
+	// the first one is taken by the delivery stuck on the server, the queue
+	// fills up behind it
+	started := time.Now()
+	for i := 0; i < queueSize+5; i++ {
+		d.Send(payload())
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("Send blocked for %s", elapsed)
+	}
+
+	dropped := 0
+	for len(errs) > 0 {
+		if err := <-errs; strings.Contains(err.Error(), "dropped") {
+			dropped++
+		}
+	}
+	// the delivery may not have taken the first payload yet
+	if dropped != 4 && dropped != 5 {
+		t.Errorf("%d payloads dropped, want 4 or 5", dropped)
+	}
+
+	close(release)
+	closeDispatcher(t, d)
+}
@@ -1,15 +1,17 @@
+//go:build windows
+
 package wexpmonitor
 
 import (
 	"context"
 	"exputils/utils"
 	"fmt"
-	"os"
+	"runtime"
+	"sync"
 	"syscall"
 	"time"
 	"unsafe"
 
-	"github.com/go-ole/go-ole"
 	"golang.org/x/sys/windows"
 )
 
@@ -18,6 +20,9 @@ const (
 	eventSystemForeground     = uintptr(0x0003)
 	eventObjectValueChange    = uintptr(0x800E)
 	eventObjectLocationChange = uintptr(0x800B)
+
+	wmQuit     = uintptr(0x0012)
+	pmNoRemove = uintptr(0x0000)
 )
 
 var (
@@ -28,6 +33,10 @@ var (
 	getForegroundWindow = user32.NewProc("GetForegroundWindow")
 	isWindow            = user32.NewProc("IsWindow")
 	translateMessage    = user32.NewProc("TranslateMessage")
+	getMessage          = user32.NewProc("GetMessageW")
+	peekMessage         = user32.NewProc("PeekMessageW")
+	dispatchMessage     = user32.NewProc("DispatchMessageW")
+	postThreadMessage   = user32.NewProc("PostThreadMessageW")
 
 	matchClasses = []string{
 		"CabinetWClass",
@@ -61,84 +70,158 @@ func init() {
 	}
 }
 
-// This is actually more resource intensive than just polling the path
-func MonitorWindowsExplorer(ctx context.Context, pathChan chan<- string, forceUpdateChan <-chan struct{}) {
+// msg is the MSG of user32, with the sizes of the platform.
+type msg struct {
+	hwnd     uintptr
+	message  uint32
+	wParam   uintptr
+	lParam   uintptr
+	time     uint32
+	pt       struct{ x, y int32 }
+	lPrivate uint32
+}
+
+var (
+	// winEventCallback is shared by every hook, callbacks can't be freed
+	// and there's a limited number of them.
+	winEventCallback = windows.NewCallback(onWinEvent)
+	// winEventHandlers are the handlers of the hooks set, by hook.
+	winEventHandlers sync.Map
+)
+
+func onWinEvent(hWinEventHook, event, hwnd, idObject, idChild, eventThread, eventTime uintptr) uintptr {
+	handler, ok := winEventHandlers.Load(hWinEventHook)
+	if !ok {
+		return 0
+	}
+	if event != eventSystemForeground && event != eventObjectValueChange && event != eventObjectLocationChange {
+		return 0
+	}
+	if ret, _, _ := isWindow.Call(hwnd); ret == 0 {
+		return 0
+	}
+
+	className := make([]uint16, 256)
+	getClassName.Call(hwnd, uintptr(unsafe.Pointer(&className[0])), 256)
+	class := syscall.UTF16ToString(className)
+	for _, c := range matchClasses {
+		if c == class {
+			handler.(func())()
+			break
+		}
+	}
+	return 0
+}
+
+// MonitorWindowsExplorer sends the path of the foreground Explorer window to
+// pathChan whenever Explorer windows change, and whenever forceUpdateChan
+// gets something. It returns once the event hook is set, or with the error
+// if it can't be, the monitoring goes on until ctx is done. onError gets the
+// errors of the monitoring.
+//
+// This is actually more resource intensive than just polling the path.
+func MonitorWindowsExplorer(
+	ctx context.Context,
+	pathChan chan<- string,
+	forceUpdateChan <-chan struct{},
+	onError func(error),
+) error {
+	var mutex sync.Mutex
 	lastPath := ""
 	debouncedGetLastViewedExplorerPath := utils.Debouncer(100*time.Millisecond, func() {
 		time.Sleep(50 * time.Millisecond)
-		if path, err := GetLastViewedExplorerPath(); err != nil {
-			fmt.Println("Failed to get last viewed Explorer path:", err)
-		} else if path != "" && path != lastPath {
+		if ctx.Err() != nil {
+			return
+		}
+		path, err := GetLastViewedExplorerPath()
+		if err != nil {
+			onError(fmt.Errorf("can't get the Explorer path: %w", err))
+			return
+		}
+
+		mutex.Lock()
+		changed := path != "" && path != lastPath
+		if changed {
 			lastPath = path
-			pathChan <- path
+		}
+		mutex.Unlock()
+		if changed {
+			select {
+			case pathChan <- path:
+			case <-ctx.Done():
+			}
 		}
 	})
 
+	hooked := make(chan error, 1)
+	// the hook is tied to the thread setting it, which must run the message
+	// loop delivering its events
 	go func() {
-		for range forceUpdateChan {
-			select {
-			case <-ctx.Done():
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
+		// makes the message queue of the thread, so WM_QUIT can be posted
+		var m msg
+		peekMessage.Call(uintptr(unsafe.Pointer(&m)), 0, 0, 0, pmNoRemove)
+
+		hook, _, err := setWinEventHook.Call(
+			eventSystemForeground,
+			eventObjectValueChange,
+			0,
+			winEventCallback,
+			0,
+			0,
+			winEventOutOfContext,
+		)
+		if hook == 0 {
+			hooked <- fmt.Errorf("can't set the event hook: %w", err)
+			return
+		}
+		winEventHandlers.Store(hook, debouncedGetLastViewedExplorerPath)
+		defer func() {
+			winEventHandlers.Delete(hook)
+			unhookWinEvent.Call(hook)
+		}()
+		hooked <- nil
+
+		// GetMessage blocks, WM_QUIT is the only way out of it
+		threadID := windows.GetCurrentThreadId()
+		stop := context.AfterFunc(ctx, func() {
+			postThreadMessage.Call(uintptr(threadID), wmQuit, 0, 0)
+		})
+		defer stop()
+
+		for {
+			ret, _, err := getMessage.Call(uintptr(unsafe.Pointer(&m)), 0, 0, 0)
+			switch int32(ret) {
+			case 0:
+				return
+			case -1:
+				if ctx.Err() == nil {
+					onError(fmt.Errorf("event loop failed: %w", err))
+				}
 				return
-			default:
-				debouncedGetLastViewedExplorerPath()
 			}
+			translateMessage.Call(uintptr(unsafe.Pointer(&m)))
+			dispatchMessage.Call(uintptr(unsafe.Pointer(&m)))
 		}
 	}()
+	if err := <-hooked; err != nil {
+		return err
+	}
 
-	hook, _, err := setWinEventHook.Call(
-		eventSystemForeground,
-		eventObjectValueChange,
-		0,
-		windows.NewCallback(func(hWinEventHook, event, hwnd, idObject, idChild, eventThread, eventTime uintptr) uintptr {
+	go func() {
+		for {
 			select {
 			case <-ctx.Done():
-				return 0 // Exit callback if context is cancelled
-			default:
-				ret, _, _ := isWindow.Call(hwnd)
-				if ret == 0 {
-					return 0
-				}
-
-				if event == eventSystemForeground || event == eventObjectValueChange || event == eventObjectLocationChange {
-					className := make([]uint16, 256)
-					getClassName.Call(hwnd, uintptr(unsafe.Pointer(&className[0])), 256)
-					class := syscall.UTF16ToString(className)
-
-					for _, c := range matchClasses {
-						if c == class {
-							debouncedGetLastViewedExplorerPath()
-							break
-						}
-					}
+				return
+			case _, ok := <-forceUpdateChan:
+				if !ok {
+					return
 				}
-
-				return 0
-			}
-		}),
-		0,
-		0,
-		winEventOutOfContext,
-	)
-	if err != nil && err != windows.ERROR_SUCCESS {
-		fmt.Println("Failed to set event hook:", err)
-		os.Exit(1)
-	}
-
-	defer unhookWinEvent.Call(hook)
-
-	var msg ole.Msg
-	for {
-		select {
-		case <-ctx.Done():
-			fmt.Println("Context cancelled, exiting MonitorWindowsExplorer")
-			return
-		default:
-			ret, _ := ole.GetMessage(&msg, 0, 0, 0)
-			if ret == 0 {
-				break
+				debouncedGetLastViewedExplorerPath()
 			}
-			translateMessage.Call(uintptr(unsafe.Pointer(&msg)))
-			ole.DispatchMessage(&msg)
 		}
-	}
+	}()
+	return nil
 }